@@ -0,0 +1,74 @@
+// Command coverage checks offline whether the agents' local relay decisions
+// cover a whole topology. The topology is read as an edge list, one
+// "node1 node2" pair per line; lines starting with # are ignored.
+//
+//	coverage [-mode mlst|spt|hybrid] [-depth n] topology.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"github.com/meixiezichuan/broadcast-gossip/gossip"
+	"io"
+	"os"
+	"strings"
+)
+
+func readTopology(r io.Reader) (*common.Graph, error) {
+	g := common.NewGraph()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want two nodes, got %q", line, text)
+		}
+		g.AddEdge(fields[0], fields[1])
+	}
+	return g, scanner.Err()
+}
+
+func main() {
+	mode := flag.String("mode", common.TreeMLST, "tree builder: mlst, spt or hybrid")
+	depth := flag.Int("depth", 0, "depth limit of the hybrid tree builder")
+	flag.Parse()
+
+	in := os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Println("Open topology error:", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		in = f
+	}
+	topo, err := readTopology(in)
+	if err != nil {
+		fmt.Println("Read topology error:", err)
+		os.Exit(2)
+	}
+
+	report := gossip.VerifyCoverage(topo, *mode, *depth)
+	for _, o := range report.Origins {
+		maxHops := 0
+		for _, h := range o.Hops {
+			if h > maxHops {
+				maxHops = h
+			}
+		}
+		fmt.Printf("origin %s: relays=%v redundant=%v uncovered=%v max hops=%d tree depth=%d\n",
+			o.Origin, o.Relays, o.Redundant, o.Uncovered, maxHops, o.TreeDepth)
+		fmt.Printf("  hops: %v\n", o.Hops)
+	}
+	if !report.Covered() {
+		fmt.Println("coverage check FAILED")
+		os.Exit(1)
+	}
+	fmt.Println("coverage check passed")
+}
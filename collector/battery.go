@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BatteryCollector reports the charge of the first battery found under
+// /sys/class/power_supply. Nodes without a battery report nothing.
+type BatteryCollector struct {
+	Root string
+}
+
+func (c *BatteryCollector) Name() string { return "battery" }
+
+func (c *BatteryCollector) Collect() ([]Metric, error) {
+	dir := path(c.Root, "/sys/class/power_supply")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	for _, e := range entries {
+		supply := dir + "/" + e.Name()
+		if read(supply+"/type") != "Battery" {
+			continue
+		}
+		capacity, err := strconv.ParseFloat(read(supply+"/capacity"), 64)
+		if err != nil {
+			continue
+		}
+		var charging float64
+		if s := read(supply + "/status"); s == "Charging" || s == "Full" {
+			charging = 1
+		}
+		return []Metric{
+			{Name: "battery.capacity", Unit: UnitPercent, Value: capacity},
+			{Name: "battery.charging", Unit: UnitBool, Value: charging},
+		}, nil
+	}
+	return nil, nil
+}
+
+// read returns the trimmed content of a sysfs attribute, "" if unreadable.
+func read(file string) string {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
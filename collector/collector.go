@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"path/filepath"
+)
+
+// Unit tells how the value of a Metric is to be read.
+type Unit string
+
+const (
+	UnitNone    Unit = ""
+	UnitPercent Unit = "percent"
+	UnitBytes   Unit = "bytes"
+	UnitBool    Unit = "bool"
+)
+
+// Metric is one typed measurement. Bool metrics are 1 or 0.
+type Metric struct {
+	Name  string
+	Unit  Unit
+	Value float64
+}
+
+// Collector reads a set of metrics from the node.
+type Collector interface {
+	Name() string
+	Collect() ([]Metric, error)
+}
+
+// Default returns the built-in collectors reading the file system mounted
+// at root, "" meaning the host's own.
+func Default(root string) []Collector {
+	return []Collector{
+		&CPUCollector{Root: root},
+		&MemoryCollector{Root: root},
+		&BatteryCollector{Root: root},
+		&LoadCollector{Root: root},
+		&DiskCollector{Path: path(root, "/")},
+	}
+}
+
+// path joins the absolute path p to root.
+func path(root, p string) string {
+	return filepath.Join(root, p)
+}
@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeRoot builds a file tree from path -> content under a temporary
+// directory and returns its root.
+func fakeRoot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for p, content := range files {
+		full := filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func metrics(ms []Metric) map[string]float64 {
+	m := make(map[string]float64)
+	for _, x := range ms {
+		m[x.Name] = x.Value
+	}
+	return m
+}
+
+func TestCPUDelta(t *testing.T) {
+	root := fakeRoot(t, map[string]string{
+		"proc/stat": "cpu  100 0 100 600 200 0 0 0 0 0\ncpu0 50 0 50 300 100 0 0 0 0 0\n",
+	})
+	c := &CPUCollector{Root: root}
+	ms, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metrics(ms)["cpu.usage"]; got != 20 {
+		t.Errorf("usage since boot = %v, want 20", got)
+	}
+
+	// 300 more busy and 100 more idle jiffies
+	if err := os.WriteFile(filepath.Join(root, "proc/stat"), []byte("cpu  300 0 200 700 200 0 0 0 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ms, err = c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metrics(ms)["cpu.usage"]; got != 75 {
+		t.Errorf("usage between reads = %v, want 75", got)
+	}
+
+	// no time passed at all
+	ms, err = c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metrics(ms)["cpu.usage"]; got != 0 {
+		t.Errorf("usage without progress = %v, want 0", got)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		meminfo string
+		avail   float64
+	}{
+		{"MemAvailable", "MemTotal: 1000 kB\nMemFree: 100 kB\nMemAvailable: 250 kB\n", 250 * 1024},
+		{"before 3.14", "MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 50 kB\nCached: 150 kB\n", 300 * 1024},
+	}
+	for _, tt := range tests {
+		c := &MemoryCollector{Root: fakeRoot(t, map[string]string{"proc/meminfo": tt.meminfo})}
+		ms, err := c.Collect()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		m := metrics(ms)
+		if m["mem.total"] != 1000*1024 || m["mem.available"] != tt.avail {
+			t.Errorf("%s: total %v available %v, want %v %v", tt.name, m["mem.total"], m["mem.available"], 1000*1024, tt.avail)
+		}
+		if want := 100 * (1000*1024 - tt.avail) / (1000 * 1024); m["mem.usage"] != want {
+			t.Errorf("%s: usage %v, want %v", tt.name, m["mem.usage"], want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := &LoadCollector{Root: fakeRoot(t, map[string]string{"proc/loadavg": "0.50 0.25 0.10 1/100 1234\n"})}
+	ms, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics(ms)
+	if m["load.1"] != 0.5 || m["load.5"] != 0.25 || m["load.15"] != 0.1 {
+		t.Errorf("got %v", m)
+	}
+}
+
+func TestBattery(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		capacity float64
+		charging float64
+		none     bool
+	}{
+		{
+			name: "discharging",
+			files: map[string]string{
+				"sys/class/power_supply/AC/type":       "Mains\n",
+				"sys/class/power_supply/BAT0/type":     "Battery\n",
+				"sys/class/power_supply/BAT0/capacity": "42\n",
+				"sys/class/power_supply/BAT0/status":   "Discharging\n",
+				"sys/class/power_supply/BAT1/type":     "Battery\n",
+				"sys/class/power_supply/BAT1/capacity": "99\n",
+				"sys/class/power_supply/BAT1/status":   "Full\n",
+			},
+			capacity: 42,
+		},
+		{
+			name: "charging",
+			files: map[string]string{
+				"sys/class/power_supply/BAT0/type":     "Battery\n",
+				"sys/class/power_supply/BAT0/capacity": "80\n",
+				"sys/class/power_supply/BAT0/status":   "Charging\n",
+			},
+			capacity: 80,
+			charging: 1,
+		},
+		{
+			name:  "mains only",
+			files: map[string]string{"sys/class/power_supply/AC/type": "Mains\n"},
+			none:  true,
+		},
+		{
+			name:  "no power_supply class",
+			files: map[string]string{"proc/loadavg": "0 0 0\n"},
+			none:  true,
+		},
+	}
+	for _, tt := range tests {
+		c := &BatteryCollector{Root: fakeRoot(t, tt.files)}
+		ms, err := c.Collect()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.none {
+			if len(ms) != 0 {
+				t.Errorf("%s: got %v, want no metrics", tt.name, ms)
+			}
+			continue
+		}
+		m := metrics(ms)
+		if m["battery.capacity"] != tt.capacity || m["battery.charging"] != tt.charging {
+			t.Errorf("%s: got %v", tt.name, m)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Collector
+		file string
+		data string
+	}{
+		{"stat without cpu line", &CPUCollector{}, "proc/stat", "intr 1 2 3\n"},
+		{"stat with text", &CPUCollector{}, "proc/stat", "cpu  a b c d e\n"},
+		{"meminfo without total", &MemoryCollector{}, "proc/meminfo", "MemFree: 100 kB\n"},
+		{"short loadavg", &LoadCollector{}, "proc/loadavg", "0.5\n"},
+		{"loadavg with text", &LoadCollector{}, "proc/loadavg", "x y z 1/1 1\n"},
+	}
+	for _, tt := range tests {
+		root := fakeRoot(t, map[string]string{tt.file: tt.data})
+		switch c := tt.c.(type) {
+		case *CPUCollector:
+			c.Root = root
+		case *MemoryCollector:
+			c.Root = root
+		case *LoadCollector:
+			c.Root = root
+		}
+		if ms, err := tt.c.Collect(); err == nil {
+			t.Errorf("%s: got %v, want an error", tt.name, ms)
+		}
+	}
+
+	// missing files are errors too
+	for _, c := range []Collector{&CPUCollector{Root: t.TempDir()}, &MemoryCollector{Root: t.TempDir()}, &LoadCollector{Root: t.TempDir()}} {
+		if _, err := c.Collect(); err == nil {
+			t.Errorf("%s: no error for a missing file", c.Name())
+		}
+	}
+
+	// a battery with an unreadable capacity is skipped
+	c := &BatteryCollector{Root: fakeRoot(t, map[string]string{
+		"sys/class/power_supply/BAT0/type":     "Battery\n",
+		"sys/class/power_supply/BAT0/capacity": "lots\n",
+	})}
+	if ms, err := c.Collect(); err != nil || len(ms) != 0 {
+		t.Errorf("bad capacity: got %v %v, want nothing", ms, err)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	c := &DiskCollector{Path: t.TempDir()}
+	ms, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics(ms)
+	if m["disk.total"] <= 0 || m["disk.free"] > m["disk.total"] {
+		t.Errorf("got %v", m)
+	}
+	if _, err := (&DiskCollector{Path: filepath.Join(t.TempDir(), "missing")}).Collect(); err == nil {
+		t.Errorf("no error for a missing path")
+	}
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"syscall"
+)
+
+// DiskCollector reports the usage of the file system holding Path.
+type DiskCollector struct {
+	Path string
+}
+
+func (c *DiskCollector) Name() string { return "disk" }
+
+func (c *DiskCollector) Collect() ([]Metric, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(c.Path, &st); err != nil {
+		return nil, err
+	}
+	total := float64(st.Blocks) * float64(st.Bsize)
+	free := float64(st.Bavail) * float64(st.Bsize)
+	ms := []Metric{
+		{Name: "disk.total", Unit: UnitBytes, Value: total},
+		{Name: "disk.free", Unit: UnitBytes, Value: free},
+	}
+	if total > 0 {
+		ms = append(ms, Metric{Name: "disk.usage", Unit: UnitPercent, Value: 100 * (total - free) / total})
+	}
+	return ms, nil
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CPUCollector reports the CPU usage from /proc/stat. The first reading
+// covers the time since boot, later ones the time since the previous call.
+type CPUCollector struct {
+	Root       string
+	busy, idle uint64
+}
+
+func (c *CPUCollector) Name() string { return "cpu" }
+
+func (c *CPUCollector) Collect() ([]Metric, error) {
+	f, err := os.Open(path(c.Root, "/proc/stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var busy, idle uint64
+		for i, v := range fields[1:] {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad /proc/stat field %q: %v", v, err)
+			}
+			// idle and iowait
+			if i == 3 || i == 4 {
+				idle += n
+			} else {
+				busy += n
+			}
+		}
+		db, di := busy-c.busy, idle-c.idle
+		c.busy, c.idle = busy, idle
+		if db+di == 0 {
+			return []Metric{{Name: "cpu.usage", Unit: UnitPercent}}, nil
+		}
+		usage := 100 * float64(db) / float64(db+di)
+		return []Metric{{Name: "cpu.usage", Unit: UnitPercent, Value: usage}}, nil
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no cpu line in /proc/stat")
+}
+
+// MemoryCollector reports total and available memory from /proc/meminfo.
+type MemoryCollector struct {
+	Root string
+}
+
+func (c *MemoryCollector) Name() string { return "memory" }
+
+func (c *MemoryCollector) Collect() ([]Metric, error) {
+	f, err := os.Open(path(c.Root, "/proc/meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := make(map[string]float64)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		// values are given in kB
+		if len(fields) > 2 && fields[2] == "kB" {
+			v *= 1024
+		}
+		info[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	total, exist := info["MemTotal"]
+	if !exist || total == 0 {
+		return nil, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	avail, exist := info["MemAvailable"]
+	if !exist {
+		// kernels before 3.14
+		avail = info["MemFree"] + info["Buffers"] + info["Cached"]
+	}
+	return []Metric{
+		{Name: "mem.total", Unit: UnitBytes, Value: total},
+		{Name: "mem.available", Unit: UnitBytes, Value: avail},
+		{Name: "mem.usage", Unit: UnitPercent, Value: 100 * (total - avail) / total},
+	}, nil
+}
+
+// LoadCollector reports the load averages from /proc/loadavg.
+type LoadCollector struct {
+	Root string
+}
+
+func (c *LoadCollector) Name() string { return "load" }
+
+func (c *LoadCollector) Collect() ([]Metric, error) {
+	b, err := os.ReadFile(path(c.Root, "/proc/loadavg"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("bad /proc/loadavg %q", b)
+	}
+	var ms []Metric
+	for i, name := range []string{"load.1", "load.5", "load.15"} {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad /proc/loadavg field %q: %v", fields[i], err)
+		}
+		ms = append(ms, Metric{Name: name, Value: v})
+	}
+	return ms, nil
+}
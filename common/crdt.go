@@ -0,0 +1,330 @@
+package common
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+)
+
+// GCounter is a grow-only counter, one count per replica.
+type GCounter map[string]uint64
+
+// Inc adds n to the count of replica.
+func (c GCounter) Inc(replica string, n uint64) {
+	c[replica] += n
+}
+
+func (c GCounter) Value() uint64 {
+	var v uint64
+	for _, n := range c {
+		v += n
+	}
+	return v
+}
+
+// Merge takes the larger count of every replica from o.
+func (c GCounter) Merge(o GCounter) {
+	for r, n := range o {
+		if cur, exist := c[r]; !exist || n > cur {
+			c[r] = n
+		}
+	}
+}
+
+// PNCounter is a counter that can go up and down, kept as two GCounters.
+type PNCounter struct {
+	P GCounter
+	N GCounter
+}
+
+func NewPNCounter() PNCounter {
+	return PNCounter{P: make(GCounter), N: make(GCounter)}
+}
+
+// Add adds delta, which may be negative, to the count of replica.
+func (c PNCounter) Add(replica string, delta int64) {
+	if delta >= 0 {
+		c.P.Inc(replica, uint64(delta))
+	} else {
+		c.N.Inc(replica, uint64(-delta))
+	}
+}
+
+func (c PNCounter) Value() int64 {
+	return int64(c.P.Value()) - int64(c.N.Value())
+}
+
+func (c PNCounter) Merge(o PNCounter) {
+	c.P.Merge(o.P)
+	c.N.Merge(o.N)
+}
+
+// ORSet is an observed-remove set without tombstones. Every add is a dot,
+// the replica and its add sequence number. A removed element simply loses
+// its dots, Clock records every dot a replica has seen, so a merge can tell
+// a dot removed on one side from one the other side never saw. A concurrent
+// add wins over a remove.
+type ORSet struct {
+	// Entries maps every element to its live dots, replica to sequence.
+	Entries map[string]map[string]uint64
+	Clock   map[string]uint64
+}
+
+func NewORSet() *ORSet {
+	return &ORSet{Entries: make(map[string]map[string]uint64), Clock: make(map[string]uint64)}
+}
+
+// Add adds elem on behalf of replica.
+func (s *ORSet) Add(elem, replica string) {
+	s.Clock[replica]++
+	// the new dot covers the ones observed so far
+	s.Entries[elem] = map[string]uint64{replica: s.Clock[replica]}
+}
+
+// Remove removes elem as far as it has been observed here.
+func (s *ORSet) Remove(elem string) {
+	delete(s.Entries, elem)
+}
+
+func (s *ORSet) Contains(elem string) bool {
+	return len(s.Entries[elem]) > 0
+}
+
+// Elements returns the members of the set in order.
+func (s *ORSet) Elements() []string {
+	elems := make([]string, 0, len(s.Entries))
+	for e := range s.Entries {
+		elems = append(elems, e)
+	}
+	sort.Strings(elems)
+	return elems
+}
+
+// Merge keeps the dots both sides have and those only one side has that the
+// other side has not seen yet.
+func (s *ORSet) Merge(o *ORSet) {
+	elems := make(map[string]bool)
+	for e := range s.Entries {
+		elems[e] = true
+	}
+	for e := range o.Entries {
+		elems[e] = true
+	}
+	for e := range elems {
+		mine, theirs := s.Entries[e], o.Entries[e]
+		dots := make(map[string]uint64)
+		for r, seq := range mine {
+			if theirs[r] == seq || seq > o.Clock[r] {
+				dots[r] = seq
+			}
+		}
+		for r, seq := range theirs {
+			if mine[r] == seq || seq > s.Clock[r] {
+				dots[r] = seq
+			}
+		}
+		if len(dots) == 0 {
+			delete(s.Entries, e)
+		} else {
+			s.Entries[e] = dots
+		}
+	}
+	for r, seq := range o.Clock {
+		if seq > s.Clock[r] {
+			s.Clock[r] = seq
+		}
+	}
+}
+
+// LWWRegister holds the value written last. Writes are ordered by Time,
+// ties broken by Replica.
+type LWWRegister struct {
+	Value   Value
+	Time    int64
+	Replica string
+}
+
+// Newer reports whether r was written after o.
+func (r LWWRegister) Newer(o LWWRegister) bool {
+	if r.Time != o.Time {
+		return r.Time > o.Time
+	}
+	return r.Replica > o.Replica
+}
+
+// CRDTState is a set of named CRDTs replicated on every node.
+type CRDTState struct {
+	GCounters  map[string]GCounter
+	PNCounters map[string]PNCounter
+	ORSets     map[string]*ORSet
+	Registers  map[string]LWWRegister
+}
+
+func NewCRDTState() *CRDTState {
+	return &CRDTState{
+		GCounters:  make(map[string]GCounter),
+		PNCounters: make(map[string]PNCounter),
+		ORSets:     make(map[string]*ORSet),
+		Registers:  make(map[string]LWWRegister),
+	}
+}
+
+// GCounter returns the counter called name, creating it if needed.
+func (s *CRDTState) GCounter(name string) GCounter {
+	c, exist := s.GCounters[name]
+	if !exist {
+		c = make(GCounter)
+		s.GCounters[name] = c
+	}
+	return c
+}
+
+// PNCounter returns the counter called name, creating it if needed.
+func (s *CRDTState) PNCounter(name string) PNCounter {
+	c, exist := s.PNCounters[name]
+	if !exist {
+		c = NewPNCounter()
+		s.PNCounters[name] = c
+	}
+	return c
+}
+
+// ORSet returns the set called name, creating it if needed.
+func (s *CRDTState) ORSet(name string) *ORSet {
+	c, exist := s.ORSets[name]
+	if !exist {
+		c = NewORSet()
+		s.ORSets[name] = c
+	}
+	return c
+}
+
+// Keys of the objects of a CRDTState, the kind prefixed to the name.
+func GCounterKey(name string) string  { return "g:" + name }
+func PNCounterKey(name string) string { return "pn:" + name }
+func ORSetKey(name string) string     { return "or:" + name }
+func RegisterKey(name string) string  { return "lww:" + name }
+
+// objects returns every object of s by key.
+func (s *CRDTState) objects() map[string]interface{} {
+	objs := make(map[string]interface{})
+	for name, c := range s.GCounters {
+		objs[GCounterKey(name)] = c
+	}
+	for name, c := range s.PNCounters {
+		objs[PNCounterKey(name)] = c
+	}
+	for name, c := range s.ORSets {
+		objs[ORSetKey(name)] = c
+	}
+	for name, r := range s.Registers {
+		objs[RegisterKey(name)] = r
+	}
+	return objs
+}
+
+// hash returns a hash of the encoded obj. Map keys are encoded in order, so
+// equal objects hash equally on every node.
+func hash(obj interface{}) uint64 {
+	b, _ := json.Marshal(obj)
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// Digest returns a hash of every object of s by key. Two replicas hold the
+// same object exactly when its digests are equal.
+func (s *CRDTState) Digest() map[string]uint64 {
+	d := make(map[string]uint64)
+	for k, obj := range s.objects() {
+		d[k] = hash(obj)
+	}
+	return d
+}
+
+// Differs returns the keys of the objects of s that are missing from, or
+// different in, digest d, in order.
+func (s *CRDTState) Differs(d map[string]uint64) []string {
+	var keys []string
+	for k, h := range s.Digest() {
+		if dh, exist := d[k]; !exist || dh != h {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Select returns the objects of s with the given keys. They are shared with
+// s, not copied.
+func (s *CRDTState) Select(keys []string) *CRDTState {
+	sel := NewCRDTState()
+	objs := s.objects()
+	for _, k := range keys {
+		switch obj := objs[k].(type) {
+		case GCounter:
+			sel.GCounters[k[len("g:"):]] = obj
+		case PNCounter:
+			sel.PNCounters[k[len("pn:"):]] = obj
+		case *ORSet:
+			sel.ORSets[k[len("or:"):]] = obj
+		case LWWRegister:
+			sel.Registers[k[len("lww:"):]] = obj
+		}
+	}
+	return sel
+}
+
+// Merge merges o into s and returns the keys of the objects that changed.
+// Merging is commutative, associative and idempotent, so replicas converge
+// whatever the order or duplication of the states they receive.
+func (s *CRDTState) Merge(o *CRDTState) []string {
+	if o == nil {
+		return nil
+	}
+	var changed []string
+	merge := func(key string, before interface{}, exist bool, merge func() interface{}) {
+		var h uint64
+		if exist {
+			h = hash(before)
+		}
+		if after := merge(); !exist || hash(after) != h {
+			changed = append(changed, key)
+		}
+	}
+	for name, c := range o.GCounters {
+		cur, exist := s.GCounters[name]
+		merge(GCounterKey(name), cur, exist, func() interface{} {
+			s.GCounter(name).Merge(c)
+			return s.GCounters[name]
+		})
+	}
+	for name, c := range o.PNCounters {
+		cur, exist := s.PNCounters[name]
+		merge(PNCounterKey(name), cur, exist, func() interface{} {
+			s.PNCounter(name).Merge(c)
+			return s.PNCounters[name]
+		})
+	}
+	for name, c := range o.ORSets {
+		if c == nil {
+			continue
+		}
+		cur, exist := s.ORSets[name]
+		merge(ORSetKey(name), cur, exist, func() interface{} {
+			s.ORSet(name).Merge(c)
+			return s.ORSets[name]
+		})
+	}
+	for name, r := range o.Registers {
+		cur, exist := s.Registers[name]
+		merge(RegisterKey(name), cur, exist, func() interface{} {
+			if !exist || r.Newer(cur) {
+				s.Registers[name] = r
+			}
+			return s.Registers[name]
+		})
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,176 @@
+package common
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomReplica applies random operations on behalf of replica.
+func randomReplica(rng *rand.Rand, replica string, ops int) *CRDTState {
+	s := NewCRDTState()
+	elems := []string{"a", "b", "c", "d"}
+	for i := 0; i < ops; i++ {
+		switch rng.Intn(5) {
+		case 0:
+			s.GCounter("g").Inc(replica, uint64(rng.Intn(5)))
+		case 1:
+			s.PNCounter("pn").Add(replica, int64(rng.Intn(11)-5))
+		case 2:
+			s.ORSet("set").Add(elems[rng.Intn(len(elems))], replica)
+		case 3:
+			s.ORSet("set").Remove(elems[rng.Intn(len(elems))])
+		case 4:
+			s.Registers["reg"] = LWWRegister{Value: NumberValue(float64(rng.Intn(100))), Time: int64(rng.Intn(10)), Replica: replica}
+		}
+	}
+	return s
+}
+
+// copyState returns a deep copy of s, as a replica receiving it would hold.
+func copyState(t *testing.T, s *CRDTState) *CRDTState {
+	t.Helper()
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCRDTState()
+	if err := json.Unmarshal(b, c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func merged(t *testing.T, states ...*CRDTState) *CRDTState {
+	m := NewCRDTState()
+	for _, s := range states {
+		m.Merge(copyState(t, s))
+	}
+	return m
+}
+
+func TestCRDTMergeLaws(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		a := randomReplica(rng, "A", 20)
+		b := randomReplica(rng, "B", 20)
+		c := randomReplica(rng, "C", 20)
+		// the replicas also saw some of each other's state
+		b.Merge(copyState(t, a))
+		b = merged(t, b, randomReplica(rng, "B", 10))
+
+		if ab, ba := merged(t, a, b), merged(t, b, a); !reflect.DeepEqual(ab.Digest(), ba.Digest()) {
+			t.Fatalf("merge is not commutative:\n%+v\n%+v", ab, ba)
+		}
+		if x, y := merged(t, merged(t, a, b), c), merged(t, a, merged(t, b, c)); !reflect.DeepEqual(x.Digest(), y.Digest()) {
+			t.Fatalf("merge is not associative")
+		}
+		aa := merged(t, a)
+		if changed := aa.Merge(copyState(t, a)); len(changed) != 0 || !reflect.DeepEqual(aa.Digest(), a.Digest()) {
+			t.Fatalf("merge is not idempotent, changed %v", changed)
+		}
+	}
+}
+
+func TestCRDTConvergence(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	var states []*CRDTState
+	for _, r := range []string{"A", "B", "C", "D"} {
+		states = append(states, randomReplica(rng, r, 30))
+	}
+	var want map[string]uint64
+	for i := 0; i < 10; i++ {
+		// every replica gets every state, in any order and duplicated
+		s := NewCRDTState()
+		for _, j := range rng.Perm(len(states)) {
+			for k := 0; k <= rng.Intn(3); k++ {
+				s.Merge(copyState(t, states[j]))
+			}
+		}
+		if want == nil {
+			want = s.Digest()
+		} else if got := s.Digest(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("replicas diverge: %v != %v", got, want)
+		}
+	}
+}
+
+func TestCounters(t *testing.T) {
+	a, b := NewCRDTState(), NewCRDTState()
+	a.GCounter("g").Inc("A", 3)
+	b.GCounter("g").Inc("B", 4)
+	a.PNCounter("pn").Add("A", 10)
+	b.PNCounter("pn").Add("B", -3)
+	a.Merge(copyState(t, b))
+	a.Merge(copyState(t, b))
+	if v := a.GCounters["g"].Value(); v != 7 {
+		t.Errorf("GCounter = %d, want 7", v)
+	}
+	if v := a.PNCounters["pn"].Value(); v != 7 {
+		t.Errorf("PNCounter = %d, want 7", v)
+	}
+}
+
+func TestORSet(t *testing.T) {
+	a, b := NewORSet(), NewORSet()
+	a.Add("x", "A")
+	b.Merge(a)
+	// b removes x while a adds it again concurrently: the add wins
+	b.Remove("x")
+	a.Add("x", "A")
+	a.Merge(b)
+	b.Merge(a)
+	if !a.Contains("x") || !b.Contains("x") {
+		t.Errorf("concurrent add lost: %v %v", a.Elements(), b.Elements())
+	}
+
+	// an observed add is removed everywhere
+	b.Remove("x")
+	a.Merge(b)
+	if a.Contains("x") {
+		t.Errorf("removed element still in %v", a.Elements())
+	}
+
+	// removals leave nothing behind
+	for i := 0; i < 100; i++ {
+		a.Add("y", "A")
+		a.Remove("y")
+	}
+	if len(a.Entries) != 0 || len(a.Clock) != 1 {
+		t.Errorf("set keeps %d entries and %d clock entries after removals", len(a.Entries), len(a.Clock))
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s := NewCRDTState()
+	s.Registers["r"] = LWWRegister{Value: BoolValue(true), Time: 5, Replica: "A"}
+	o := NewCRDTState()
+	o.Registers["r"] = LWWRegister{Value: BoolValue(false), Time: 5, Replica: "B"}
+	if changed := s.Merge(o); !reflect.DeepEqual(changed, []string{RegisterKey("r")}) {
+		t.Errorf("changed %v", changed)
+	}
+	if v, _ := s.Registers["r"].Value.Bool(); v {
+		t.Errorf("tie not broken by replica")
+	}
+	old := NewCRDTState()
+	old.Registers["r"] = LWWRegister{Value: BoolValue(true), Time: 4, Replica: "Z"}
+	if changed := s.Merge(old); len(changed) != 0 {
+		t.Errorf("older write changed %v", changed)
+	}
+}
+
+func TestSelectAndDiffers(t *testing.T) {
+	s := NewCRDTState()
+	s.GCounter("g").Inc("A", 1)
+	s.ORSet("set").Add("x", "A")
+	o := merged(t, s)
+	o.GCounter("g").Inc("B", 1)
+	if got := s.Differs(o.Digest()); !reflect.DeepEqual(got, []string{GCounterKey("g")}) {
+		t.Errorf("Differs = %v", got)
+	}
+	sel := o.Select([]string{GCounterKey("g"), "or:missing"})
+	if len(sel.GCounters) != 1 || len(sel.ORSets) != 0 {
+		t.Errorf("Select = %+v", sel)
+	}
+}
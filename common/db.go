@@ -11,8 +11,9 @@ type Database struct {
 	db *sql.DB
 }
 
+// NewDatabase opens the database at path name with the .db extension.
 func NewDatabase(name string) (*Database, error) {
-	dbName := "./" + name + ".db"
+	dbName := name + ".db"
 	db, err := sql.Open("sqlite3", dbName)
 	if err != nil {
 		return nil, err
@@ -22,6 +23,10 @@ func NewDatabase(name string) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value INTEGER)`)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Database{db: db}, nil
 }
@@ -65,6 +70,29 @@ func (db *Database) GetAll() (map[string]NodeMessage, error) {
 	return data, nil
 }
 
+// NextBoot counts a boot of the node and returns its number. Unlike the
+// clock the counter never goes back. The first count starts from first,
+// so it stays ahead of boot IDs taken from the clock by older builds.
+func (db *Database) NextBoot(first int64) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO meta (key, value) VALUES ('boot', ?)
+		ON CONFLICT(key) DO UPDATE SET value = value + 1`, first)
+	if err != nil {
+		return 0, err
+	}
+	var boot int64
+	if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'boot'`).Scan(&boot); err != nil {
+		return 0, err
+	}
+	return boot, tx.Commit()
+}
+
 func (db *Database) DB() *sql.DB {
 	return db.db
 }
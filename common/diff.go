@@ -0,0 +1,161 @@
+package common
+
+import "sort"
+
+// Edge is an undirected edge. A always sorts before B, so two Edges describing
+// the same link compare equal.
+type Edge struct {
+	A string
+	B string
+}
+
+// NewEdge returns the normalized edge between v1 and v2.
+func NewEdge(v1, v2 string) Edge {
+	if v2 < v1 {
+		v1, v2 = v2, v1
+	}
+	return Edge{A: v1, B: v2}
+}
+
+// Has reports whether v is one of the endpoints of e.
+func (e Edge) Has(v string) bool {
+	return e.A == v || e.B == v
+}
+
+// Other returns the endpoint of e that is not v.
+func (e Edge) Other(v string) string {
+	if e.A == v {
+		return e.B
+	}
+	return e.A
+}
+
+// GraphDiff lists what changed between two graphs.
+type GraphDiff struct {
+	AddedVertices   []string
+	RemovedVertices []string
+	AddedEdges      []Edge
+	RemovedEdges    []Edge
+}
+
+// Empty reports whether the two graphs were identical.
+func (d GraphDiff) Empty() bool {
+	return len(d.AddedVertices) == 0 && len(d.RemovedVertices) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// Vertices returns the vertices of the graph in sorted order.
+func (g *Graph) Vertices() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	vs := make([]string, 0, len(g.adjList))
+	for v := range g.adjList {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// Edges returns every edge of the graph once, in sorted order.
+func (g *Graph) Edges() []Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var es []Edge
+	for v, ns := range g.adjList {
+		for _, n := range ns {
+			if v < n {
+				es = append(es, Edge{A: v, B: n})
+			}
+		}
+	}
+	sortEdges(es)
+	return es
+}
+
+// Diff reports the changes that turn g into other: vertices and edges that
+// only exist in other are added, those that only exist in g are removed.
+func (g *Graph) Diff(other *Graph) GraphDiff {
+	var d GraphDiff
+	oldV, newV := toSet(g.Vertices()), toSet(other.Vertices())
+	for v := range newV {
+		if !oldV[v] {
+			d.AddedVertices = append(d.AddedVertices, v)
+		}
+	}
+	for v := range oldV {
+		if !newV[v] {
+			d.RemovedVertices = append(d.RemovedVertices, v)
+		}
+	}
+
+	oldE, newE := edgeSet(g.Edges()), edgeSet(other.Edges())
+	for e := range newE {
+		if !oldE[e] {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for e := range oldE {
+		if !newE[e] {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+
+	sort.Strings(d.AddedVertices)
+	sort.Strings(d.RemovedVertices)
+	sortEdges(d.AddedEdges)
+	sortEdges(d.RemovedEdges)
+	return d
+}
+
+// Reachable returns, in sorted order, every vertex connected to from,
+// including from itself when it is part of the graph.
+func (g *Graph) Reachable(from string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if _, ok := g.adjList[from]; !ok {
+		return nil
+	}
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, n := range g.adjList[node] {
+			if !visited[n] {
+				visited[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	vs := make([]string, 0, len(visited))
+	for v := range visited {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+func toSet(vs []string) map[string]bool {
+	s := make(map[string]bool, len(vs))
+	for _, v := range vs {
+		s[v] = true
+	}
+	return s
+}
+
+func edgeSet(es []Edge) map[Edge]bool {
+	s := make(map[Edge]bool, len(es))
+	for _, e := range es {
+		s[e] = true
+	}
+	return s
+}
+
+func sortEdges(es []Edge) {
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].A != es[j].A {
+			return es[i].A < es[j].A
+		}
+		return es[i].B < es[j].B
+	})
+}
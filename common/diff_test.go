@@ -0,0 +1,52 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphDiff(t *testing.T) {
+	tests := []struct {
+		name         string
+		old, new     string
+		addedV, remV []string
+		addedE, remE string
+	}{
+		{"identical", "A-B B-C", "C-B B-A", nil, nil, "", ""},
+		{"edge added", "A-B B-C", "A-B B-C A-C", nil, nil, "A-C", ""},
+		{"edge removed", "A-B B-C A-C", "A-B B-C", nil, nil, "", "A-C"},
+		{"vertex added", "A-B", "A-B B-C", []string{"C"}, nil, "B-C", ""},
+		{"vertex removed", "A-B B-C C-D", "A-B", nil, []string{"C", "D"}, "", "B-C C-D"},
+		{"from empty", "", "B-A", []string{"A", "B"}, nil, "A-B", ""},
+		{"rewired", "A-B C-D", "A-C B-D", nil, nil, "A-C B-D", "A-B C-D"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := graphOf(tt.old).Diff(graphOf(tt.new))
+			if !reflect.DeepEqual(d.AddedVertices, tt.addedV) {
+				t.Errorf("added vertices %v, want %v", d.AddedVertices, tt.addedV)
+			}
+			if !reflect.DeepEqual(d.RemovedVertices, tt.remV) {
+				t.Errorf("removed vertices %v, want %v", d.RemovedVertices, tt.remV)
+			}
+			if !reflect.DeepEqual(d.AddedEdges, edgesOf(tt.addedE)) {
+				t.Errorf("added edges %v, want %v", d.AddedEdges, edgesOf(tt.addedE))
+			}
+			if !reflect.DeepEqual(d.RemovedEdges, edgesOf(tt.remE)) {
+				t.Errorf("removed edges %v, want %v", d.RemovedEdges, edgesOf(tt.remE))
+			}
+			if d.Empty() != (tt.name == "identical") {
+				t.Errorf("Empty() = %v", d.Empty())
+			}
+		})
+	}
+}
+
+func TestGraphDiffReversed(t *testing.T) {
+	g1, g2 := graphOf("A-B B-C C-D"), graphOf("A-B A-E")
+	d, r := g1.Diff(g2), g2.Diff(g1)
+	if !reflect.DeepEqual(d.AddedEdges, r.RemovedEdges) || !reflect.DeepEqual(d.RemovedEdges, r.AddedEdges) ||
+		!reflect.DeepEqual(d.AddedVertices, r.RemovedVertices) || !reflect.DeepEqual(d.RemovedVertices, r.AddedVertices) {
+		t.Errorf("diff %+v is not the reverse of %+v", d, r)
+	}
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Condition compares the value of Key with Literal.
+type Condition struct {
+	Key     string
+	Op      string
+	Literal string
+}
+
+// Filter is a conjunction of conditions on the data of a node, written like
+// "battery < 20 && role == gateway".
+type Filter []Condition
+
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// ParseFilter parses a filter expression. The empty expression matches
+// everything. String literals may be quoted, "&&" and operators inside
+// quotes are part of the literal.
+func ParseFilter(expr string) (Filter, error) {
+	var f Filter
+	if strings.TrimSpace(expr) == "" {
+		return f, nil
+	}
+	parts, err := splitConditions(expr)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		c, err := parseCondition(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		f = append(f, c)
+	}
+	return f, nil
+}
+
+// splitConditions splits expr at every "&&" outside of double quotes.
+func splitConditions(expr string) ([]string, error) {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case quoted && expr[i] == '\\':
+			i++
+		case expr[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(expr[i:], "&&"):
+			parts = append(parts, expr[start:i])
+			start = i + 2
+			i++
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", expr)
+	}
+	return append(parts, expr[start:]), nil
+}
+
+// parseCondition splits s at its first operator, whatever follows is the
+// literal.
+func parseCondition(s string) (Condition, error) {
+	if i := strings.IndexAny(s, "=!<>"); i > 0 {
+		for _, op := range filterOps {
+			if !strings.HasPrefix(s[i:], op) {
+				continue
+			}
+			c := Condition{
+				Key:     strings.TrimSpace(s[:i]),
+				Op:      op,
+				Literal: strings.TrimSpace(s[i+len(op):]),
+			}
+			if uq, err := strconv.Unquote(c.Literal); err == nil {
+				c.Literal = uq
+			}
+			if c.Key == "" || c.Literal == "" {
+				break
+			}
+			return c, nil
+		}
+	}
+	return Condition{}, fmt.Errorf("bad condition %q, want <key> <op> <value>", s)
+}
+
+// Match reports whether data satisfies every condition of f. A condition on
+// a missing key or between values of different types does not hold.
+func (f Filter) Match(data map[string]Value) bool {
+	for _, c := range f {
+		if !c.Match(data) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) Match(data map[string]Value) bool {
+	v, exist := data[c.Key]
+	if !exist {
+		return false
+	}
+	if n, ok := v.Number(); ok {
+		lit, err := strconv.ParseFloat(c.Literal, 64)
+		if err != nil {
+			return false
+		}
+		switch {
+		case n < lit:
+			return compare(c.Op, -1)
+		case n > lit:
+			return compare(c.Op, 1)
+		}
+		return compare(c.Op, 0)
+	}
+	if b, ok := v.Bool(); ok {
+		lit, err := strconv.ParseBool(c.Literal)
+		if err != nil || (c.Op != "==" && c.Op != "!=") {
+			return false
+		}
+		return (b == lit) == (c.Op == "==")
+	}
+	if s, ok := v.Text(); ok {
+		return compare(c.Op, strings.Compare(s, c.Literal))
+	}
+	return false
+}
+
+// compare tells whether op holds for a comparison result cmp.
+func compare(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
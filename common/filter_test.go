@@ -0,0 +1,88 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Filter
+		err  bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"battery < 20", Filter{{"battery", "<", "20"}}, false},
+		{"battery<=20&&role==gateway", Filter{{"battery", "<=", "20"}, {"role", "==", "gateway"}}, false},
+		{"cpu >= 0.5 && up != false", Filter{{"cpu", ">=", "0.5"}, {"up", "!=", "false"}}, false},
+		{`name == "edge 1"`, Filter{{"name", "==", "edge 1"}}, false},
+		{`msg == "a && b" && up == true`, Filter{{"msg", "==", "a && b"}, {"up", "==", "true"}}, false},
+		{`msg == "say \"&&\"" && n > 1`, Filter{{"msg", "==", `say "&&"`}, {"n", ">", "1"}}, false},
+		{"msg != a==b", Filter{{"msg", "!=", "a==b"}}, false},
+		{"n < 5>=3", Filter{{"n", "<", "5>=3"}}, false},
+		{`msg == "a && b`, nil, true},
+		{"battery", nil, true},
+		{"battery = 20", nil, true},
+		{"< 20", nil, true},
+		{"battery <", nil, true},
+		{"battery < 20 &&", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(f, tt.want) {
+				t.Errorf("filter %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	data := map[string]Value{
+		"battery": NumberValue(15),
+		"memory":  BytesValue(2048),
+		"role":    StringValue("gateway"),
+		"up":      BoolValue(true),
+		"zone":    {Kind: "geo", Value: []byte(`[1,2]`)},
+	}
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"battery < 20", true},
+		{"battery < 15", false},
+		{"battery <= 15", true},
+		{"battery == 15.0", true},
+		{"battery > 10 && role == gateway", true},
+		{"battery > 10 && role == sensor", false},
+		{"battery < abc", false},
+		{"memory >= 1024", true},
+		{"role != sensor", true},
+		{`role == "gateway"`, true},
+		{"role < h", true},
+		{"up == true", true},
+		{"up != true", false},
+		{"up < true", false},
+		{"up == 1", true},
+		{"up == yes", false},
+		{"missing == 1", false},
+		{"missing != 1", false},
+		{"zone == x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Match(data); got != tt.match {
+				t.Errorf("Match = %v, want %v", got, tt.match)
+			}
+		})
+	}
+}
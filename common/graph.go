@@ -4,12 +4,21 @@ import (
 	"container/list"
 	"fmt"
 	"sort"
+	"sync"
 )
 
-// Graph represents an undirected graph using an adjacency list with string nodes
+// Graph represents an undirected graph using an adjacency list with string nodes.
+// Every mutation bumps the version; Snapshot hands out frozen copies so readers
+// can work on a consistent view while the live graph keeps changing. Tree
+// builders and the other analysis methods run on such a snapshot, so they may
+// be called on the live graph as well.
 type Graph struct {
+	mu      sync.RWMutex
 	adjList map[string][]string
 	root    string
+	version uint64
+	frozen  bool
+	snap    *Graph
 }
 
 type DPState struct {
@@ -30,21 +39,130 @@ func (g *Graph) AddEdge(v1, v2 string) {
 	if v1 == v2 {
 		return
 	}
-	path1 := []string{v1, v2}
-	path2 := []string{v2, v1}
-	if g.PathExists(path1) || g.PathExists(path2) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.checkMutable()
+	if g.hasEdge(v1, v2) || g.hasEdge(v2, v1) {
 		return
 	}
 	g.adjList[v1] = append(g.adjList[v1], v2)
 	g.adjList[v2] = append(g.adjList[v2], v1)
+	g.touch()
 }
 
 // RemoveEdge 删除两个顶点之间的边
 func (g *Graph) RemoveEdge(v1, v2 string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.checkMutable()
+	if !g.hasEdge(v1, v2) && !g.hasEdge(v2, v1) {
+		return
+	}
 	// 删除 v1 邻接表中与 v2 的边
 	g.adjList[v1] = removeElement(g.adjList[v1], v2)
 	// 删除 v2 邻接表中与 v1 的边
 	g.adjList[v2] = removeElement(g.adjList[v2], v1)
+	// 孤立顶点不再属于图
+	for _, v := range []string{v1, v2} {
+		if len(g.adjList[v]) == 0 {
+			delete(g.adjList, v)
+		}
+	}
+	g.touch()
+}
+
+// RemoveVertex removes node together with all of its edges.
+func (g *Graph) RemoveVertex(node string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.checkMutable()
+	edges, exist := g.adjList[node]
+	if !exist {
+		return
+	}
+	for _, n := range edges {
+		g.adjList[n] = removeElement(g.adjList[n], node)
+		if len(g.adjList[n]) == 0 {
+			delete(g.adjList, n)
+		}
+	}
+	delete(g.adjList, node)
+	g.touch()
+}
+
+// hasEdge reports whether v2 is in the adjacency list of v1. Callers hold g.mu.
+func (g *Graph) hasEdge(v1, v2 string) bool {
+	for _, n := range g.adjList[v1] {
+		if n == v2 {
+			return true
+		}
+	}
+	return false
+}
+
+// touch bumps the version and drops the cached snapshot. Callers hold g.mu.
+func (g *Graph) touch() {
+	g.version++
+	g.snap = nil
+}
+
+func (g *Graph) checkMutable() {
+	if g.frozen {
+		panic("common: mutating a frozen graph snapshot")
+	}
+}
+
+// Version returns the number of mutations applied to the graph so far.
+func (g *Graph) Version() uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.version
+}
+
+// Snapshot returns a frozen copy of the graph tagged with the current version.
+// The copy is cached and shared between callers until the next mutation, so
+// taking a snapshot of an unchanged graph is cheap. Snapshots must not be
+// mutated; nothing writes to them, so the tree builders read them without
+// locking while the live graph changes.
+func (g *Graph) Snapshot() *Graph {
+	g.mu.RLock()
+	if g.frozen {
+		g.mu.RUnlock()
+		return g
+	}
+	if s := g.snap; s != nil {
+		g.mu.RUnlock()
+		return s
+	}
+	g.mu.RUnlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.snap == nil {
+		s := g.copyLocked()
+		s.frozen = true
+		g.snap = s
+	}
+	return g.snap
+}
+
+// Clone returns a mutable deep copy of the graph.
+func (g *Graph) Clone() *Graph {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.copyLocked()
+}
+
+func (g *Graph) copyLocked() *Graph {
+	adj := make(map[string][]string, len(g.adjList))
+	for v, edges := range g.adjList {
+		adj[v] = append([]string(nil), edges...)
+	}
+	return &Graph{
+		adjList: adj,
+		root:    g.root,
+		version: g.version,
+	}
 }
 
 // 辅助函数：从切片中删除指定元素
@@ -59,6 +177,7 @@ func removeElement(slice []string, element string) []string {
 
 // FindMaxLeafTree finds the maximum leaf spanning tree starting from the given root
 func (g *Graph) FindMaxLeafTree(root string) *Graph {
+	g = g.Snapshot()
 	tree := NewGraph()
 	tree.root = root
 	visited := make(map[string]bool)
@@ -81,6 +200,11 @@ func (g *Graph) FindMaxLeafTree(root string) *Graph {
 
 // GetSortedNodes returns nodes sorted by degree and name
 func (g *Graph) GetSortedNodes(nodes []string) []string {
+	return g.Snapshot().sortByDegree(nodes)
+}
+
+// sortByDegree is GetSortedNodes for callers that hold g.mu or own a snapshot.
+func (g *Graph) sortByDegree(nodes []string) []string {
 	nodeDegrees := make(map[string]int)
 	for _, node := range nodes {
 		neighbors := g.adjList[node]
@@ -92,7 +216,12 @@ func (g *Graph) GetSortedNodes(nodes []string) []string {
 	for key, _ := range nodeDegrees {
 		ns = append(ns, key)
 	}
-	sort.Slice(ns, func(i, j int) bool { return nodeDegrees[ns[i]] > nodeDegrees[ns[j]] })
+	sort.Slice(ns, func(i, j int) bool {
+		if nodeDegrees[ns[i]] != nodeDegrees[ns[j]] {
+			return nodeDegrees[ns[i]] > nodeDegrees[ns[j]]
+		}
+		return ns[i] < ns[j]
+	})
 
 	//fmt.Println("sotr nodes : ", nodes, "------------")
 	//for _, n := range ns {
@@ -103,6 +232,7 @@ func (g *Graph) GetSortedNodes(nodes []string) []string {
 
 // MinDominatingSetFromRoot 查找以指定根节点为起始的最小支配集
 func (g *Graph) MinDominatingSetFromRoot(root string) []string {
+	g = g.Snapshot()
 	dominatingSet := []string{}
 	covered := make(map[string]bool)
 
@@ -161,6 +291,7 @@ func (g *Graph) MinDominatingSetFromRoot(root string) []string {
 }
 
 func (g *Graph) MaxLeafSpanningTree(root string) (*Graph, int, []string) {
+	g = g.Snapshot()
 
 	dp := make(map[string]DPState) // DP表
 	//parent := make(map[string]string) // 记录父节点
@@ -236,6 +367,7 @@ func (g *Graph) MaxLeafSpanningTree(root string) (*Graph, int, []string) {
 }
 
 func (g *Graph) DFS(root string, dp map[string]DPState) {
+	g = g.Snapshot()
 	var stack []struct {
 		node   string
 		parent string
@@ -296,6 +428,7 @@ func (g *Graph) DFS(root string, dp map[string]DPState) {
 }
 
 func (g *Graph) BuildMDSTree(root string) *Graph {
+	g = g.Snapshot()
 	mds := g.MinDominatingSetFromRoot(root)
 	fmt.Println("mds set: ", mds)
 
@@ -334,6 +467,7 @@ func (g *Graph) BuildMDSTree(root string) *Graph {
 }
 
 func (g *Graph) BuildSpanningTree(mds []string) map[string][]string {
+	g = g.Snapshot()
 	tree := make(map[string][]string)
 	visited := make(map[string]bool)
 
@@ -361,6 +495,7 @@ func (g *Graph) BuildSpanningTree(mds []string) map[string][]string {
 }
 
 func (g *Graph) BST(root string) *Graph {
+	g = g.Snapshot()
 	mds := g.MinDominatingSetFromRoot(root)
 	adj := g.BuildSpanningTree(mds)
 	tree := NewGraph()
@@ -369,12 +504,35 @@ func (g *Graph) BST(root string) *Graph {
 	return tree
 }
 
+// Adjacency returns a copy of the adjacency list.
+func (g *Graph) Adjacency() map[string][]string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	adj := make(map[string][]string, len(g.adjList))
+	for v, edges := range g.adjList {
+		adj[v] = append([]string(nil), edges...)
+	}
+	return adj
+}
+
+// HasVertex reports whether node has at least one edge in the graph.
+func (g *Graph) HasVertex(node string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	_, ok := g.adjList[node]
+	return ok
+}
+
 func (g *Graph) FindNeighbor(node string) []string {
-	return g.adjList[node]
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]string(nil), g.adjList[node]...)
 }
 
 // IsLeaf checks if a given node is a leaf in the tree
 func (g *Graph) IsLeaf(node string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	// root node
 	if g.root == node {
 		return false
@@ -384,6 +542,7 @@ func (g *Graph) IsLeaf(node string) bool {
 }
 
 func (g *Graph) PathExistsInTree(currentNode string, path []string) bool {
+	g = g.Snapshot()
 	if path[0] != currentNode {
 		return false
 	}
@@ -417,6 +576,8 @@ func (g *Graph) PathExists(path []string) bool {
 	//}
 
 	// Not a tree
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	for i := 0; i < len(path)-1; i++ {
 		found := false
 		for _, neighbor := range g.adjList[path[i]] {
@@ -440,6 +601,7 @@ type DPMState struct {
 
 // MaxLeafSpanningTree 计算最大叶子生成树
 func (g *Graph) MLST2DFS(root string) (int, map[string][]string, []string) {
+	g = g.Snapshot()
 	dp := make(map[string]DPMState)   // DP表
 	tree := make(map[string][]string) // 记录生成树结构
 	visited := make(map[string]bool)
@@ -483,6 +645,7 @@ func (g *Graph) MLST2DFS(root string) (int, map[string][]string, []string) {
 
 // MaxLeafSpanningTree 计算最大叶子生成树
 func (g *Graph) MLSTBFS(root string) (int, map[string][]string, []string) {
+	g = g.Snapshot()
 	dp := make(map[string]DPMState)   // DP表
 	tree := make(map[string][]string) // 记录生成树结构
 	visited := make(map[string]bool)  // 记录已访问节点
@@ -556,6 +719,8 @@ func (g *Graph) MLSTBFS(root string) (int, map[string][]string, []string) {
 
 // Display prints the adjacency list of the graph
 func (g *Graph) Display() {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	for vertex, edges := range g.adjList {
 		fmt.Printf("%s -> %v\n", vertex, edges)
 	}
@@ -564,9 +729,23 @@ func (g *Graph) Display() {
 func (g *Graph) Sotred() {
 	fmt.Println("Before sorted: ---")
 	g.Display()
+	g.mu.Lock()
+	g.checkMutable()
 	for vertex, edges := range g.adjList {
-		g.adjList[vertex] = g.GetSortedNodes(edges)
+		g.adjList[vertex] = g.sortByDegree(edges)
 	}
+	g.touch()
+	g.mu.Unlock()
 	fmt.Println("After sorted: ---")
 	g.Display()
 }
+
+// sortedCopy returns a copy of g whose adjacency lists are ordered the way
+// Sotred orders them, leaving g itself untouched.
+func (g *Graph) sortedCopy() *Graph {
+	c := g.Clone()
+	for vertex, edges := range c.adjList {
+		c.adjList[vertex] = g.GetSortedNodes(edges)
+	}
+	return c
+}
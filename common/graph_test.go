@@ -0,0 +1,109 @@
+package common
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotVersioning(t *testing.T) {
+	g := graphOf("A-B B-C")
+	v := g.Version()
+	s := g.Snapshot()
+	if s.Version() != v {
+		t.Fatalf("snapshot version %d, want %d", s.Version(), v)
+	}
+	if g.Snapshot() != s {
+		t.Error("snapshot of an unchanged graph is not reused")
+	}
+	if s.Snapshot() != s {
+		t.Error("snapshot of a snapshot is a new copy")
+	}
+
+	// a no-op mutation keeps the version and the cached snapshot
+	g.AddEdge("A", "B")
+	g.RemoveEdge("A", "C")
+	if g.Version() != v || g.Snapshot() != s {
+		t.Error("no-op mutation bumped the version")
+	}
+
+	g.AddEdge("C", "D")
+	if g.Version() != v+1 {
+		t.Errorf("version %d after a mutation, want %d", g.Version(), v+1)
+	}
+	s2 := g.Snapshot()
+	if s2 == s || s2.Version() != v+1 {
+		t.Errorf("stale snapshot handed out after a mutation")
+	}
+	if !reflect.DeepEqual(s.Edges(), edgesOf("A-B B-C")) {
+		t.Errorf("old snapshot changed to %v", s.Edges())
+	}
+	if !reflect.DeepEqual(s2.Edges(), edgesOf("A-B B-C C-D")) {
+		t.Errorf("new snapshot %v", s2.Edges())
+	}
+
+	c := s2.Clone()
+	c.AddEdge("D", "E")
+	if c.Version() != v+2 || g.Version() != v+1 {
+		t.Errorf("clone version %d, graph version %d", c.Version(), g.Version())
+	}
+	if g.HasVertex("E") || s2.HasVertex("E") {
+		t.Error("mutating a clone changed its source")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("mutating a snapshot did not panic")
+		}
+	}()
+	s2.AddEdge("D", "E")
+}
+
+// Run with -race: tree builders and readers on the live graph must not race
+// with writers.
+func TestConcurrentReadersAndWriters(t *testing.T) {
+	g := graphOf("A-B B-C C-D D-E E-A")
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < 2; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for i := 0; i < 200; i++ {
+				n := "N" + strconv.Itoa(w) + "_" + strconv.Itoa(i%10)
+				g.AddEdge("A", n)
+				g.AddEdge(n, "C")
+				g.RemoveEdge("A", n)
+				if i%7 == 0 {
+					g.RemoveVertex(n)
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, mode := range []string{TreeMLST, TreeSPT, TreeHybrid} {
+					g.BuildTree(mode, "A", 2).IsLeaf("C")
+				}
+				g.IsLeaf("B")
+				g.PathExists([]string{"A", "B"})
+				g.SteinerTree("A", []string{"C", "D"})
+				g.Snapshot().Diff(g)
+				g.Reachable("A")
+				g.GetSortedNodes([]string{"A", "C"})
+			}
+		}()
+	}
+	writers.Wait()
+	close(done)
+	readers.Wait()
+}
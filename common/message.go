@@ -1,18 +1,181 @@
 package common
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Gossip消息
 type NodeMessage struct {
-	NodeID   string
-	Revision int
-	Data     map[string]string
+	NodeID string
+	// Incarnation identifies the boot of NodeID, it grows with every restart
+	// while Revision starts over from 0.
+	Incarnation int64
+	Revision    int
+	// Schema is the SchemaVersion of the sender, Data its typed state. On
+	// the wire Data holds the values as plain strings for builds before
+	// typed values, and Values the typed values, see MarshalJSON.
+	Schema int
+	Data   map[string]Value
+	// Delta marks Data as holding only the keys changed since revision Base,
+	// Deleted the keys removed since then.
+	Delta   bool
+	Base    int
+	Deleted []string
+	// Targets restricts delivery to these nodes; empty means broadcast to all.
+	Targets []string
+	// TreeMode and TreeDepth select the tree builder every relay uses for
+	// this message, see Graph.BuildTree.
+	TreeMode  string
+	TreeDepth int
+	// Leave announces that NodeID is shutting down, Signature proves it.
+	Leave     bool
+	Signature string
+}
+
+// nodeMessage is NodeMessage without its JSON methods.
+type nodeMessage NodeMessage
+
+// MarshalJSON writes Data as plain strings, the only form receivers built
+// before typed values (schema 0) can decode, and the typed values as Values.
+func (m NodeMessage) MarshalJSON() ([]byte, error) {
+	var legacy map[string]string
+	if m.Data != nil {
+		legacy = make(map[string]string, len(m.Data))
+		for k, v := range m.Data {
+			legacy[k] = v.String()
+		}
+	}
+	return json.Marshal(struct {
+		nodeMessage
+		Data   map[string]string
+		Values map[string]Value `json:",omitempty"`
+	}{nodeMessage(m), legacy, m.Data})
+}
+
+// UnmarshalJSON takes the typed Values when present and the plain strings
+// of Data otherwise, as sent by builds before typed values.
+func (m *NodeMessage) UnmarshalJSON(b []byte) error {
+	var wire struct {
+		nodeMessage
+		Values map[string]Value
+	}
+	if err := json.Unmarshal(b, &wire); err != nil {
+		return err
+	}
+	*m = NodeMessage(wire.nodeMessage)
+	if wire.Values != nil {
+		m.Data = wire.Values
+	}
+	return nil
 }
 
 type GossipMessage struct {
 	Self NodeMessage
 	Msgs []SendMessage
+	// Members piggybacks recent membership changes, the sender's own alive
+	// record always included.
+	Members []MemberUpdate
+	// Nacks asks for revisions the sender missed, Repairs answers them.
+	Nacks   []Nack
+	Repairs []NodeMessage
+	// Acks holds the version the sender stored for each of its neighbors.
+	Acks map[string]Version
+	// CRDT holds the cluster-wide CRDT objects the sender disseminates this
+	// round, CRDTDigest the digest of all objects it has.
+	CRDT       *CRDTState
+	CRDTDigest map[string]uint64
+	// Events are one-shot published events, see Agent.Publish.
+	Events []SendEvent
+	// Queries fan out like Events, Responses travel back hop by hop.
+	Queries   []SendQuery
+	Responses []Response
+}
+
+// Event is a one-shot message published to every node. Hops counts the
+// hops it travelled, it is not relayed further once Hops reaches HopLimit.
+type Event struct {
+	ID       string
+	Origin   string
+	Topic    string
+	Payload  []byte
+	Hops     int
+	HopLimit int
+}
+
+// Query asks the nodes whose data match Filter, see ParseFilter, to
+// respond within Timeout. Every hop sends the time that is left, clocks
+// of the nodes need not agree.
+type Query struct {
+	ID       string
+	Origin   string
+	Filter   string
+	Timeout  time.Duration
+	Hops     int
+	HopLimit int
+}
+
+type SendQuery struct {
+	PrevNode string
+	Query    Query
+}
+
+// Response answers query QueryID of Origin with the data of From. It is
+// only taken by NextHop, the next node on the way back to Origin.
+type Response struct {
+	QueryID string
+	Origin  string
+	From    string
+	Data    map[string]Value
+	NextHop string
+}
+
+// SendEvent relays Event, PrevNode is the node it came from like in
+// SendMessage.
+type SendEvent struct {
+	PrevNode string
+	Event    Event
 }
 
 type SendMessage struct {
 	PrevNode string
 	NodeMsg  NodeMessage
+	// Route lists the nodes NodeMsg went through, from its origin to the
+	// sender of this message.
+	Route []string
+}
+
+// MemberUpdate announces the membership state of Node at Incarnation.
+type MemberUpdate struct {
+	Node        string
+	State       string
+	Incarnation int
+}
+
+// Version orders the messages of one node, first by incarnation then by revision.
+type Version struct {
+	Incarnation int64
+	Revision    int
+}
+
+// Version returns the version of m.
+func (m NodeMessage) Version() Version {
+	return Version{Incarnation: m.Incarnation, Revision: m.Revision}
+}
+
+// Less reports whether v is older than o.
+func (v Version) Less(o Version) bool {
+	if v.Incarnation != o.Incarnation {
+		return v.Incarnation < o.Incarnation
+	}
+	return v.Revision < o.Revision
+}
+
+// Nack reports that the revisions From..To (inclusive) of Origin at
+// Incarnation never arrived.
+type Nack struct {
+	Origin      string
+	Incarnation int64
+	From        int
+	To          int
 }
@@ -7,6 +7,7 @@ import (
 
 // MaxLeafSpanningTree 计算最大叶子生成树
 func (g *Graph) MLST4(root string) (int, map[string][]string) {
+	g = g.Snapshot()
 	// DPState 定义状态
 	type DPState struct {
 		maxLeaves int
@@ -58,6 +59,7 @@ func (g *Graph) MLST4(root string) (int, map[string][]string) {
 
 // 贪心算法
 func (g *Graph) MLST5(root string) (int, []string) {
+	g = g.Snapshot()
 	visited := make(map[string]bool)
 	var maxLeaves int
 	var leafNodes []string
@@ -92,6 +94,7 @@ func (g *Graph) MLST5(root string) (int, []string) {
 }
 
 func (g *Graph) MLST6(root string) int {
+	g = g.Snapshot()
 	visited := make(map[string]bool)
 	leafCount := 0
 
@@ -122,6 +125,7 @@ func (g *Graph) MLST6(root string) int {
 
 // Function to connect root to MDS nodes and minimize tree size
 func (g *Graph) ConnectRootToMDS(root string) *Graph {
+	g = g.Snapshot()
 	mds := g.MinDominatingSetFromRoot(root)
 	fmt.Println("mds: ", mds)
 	tree := NewGraph()
@@ -196,6 +200,7 @@ func (g *Graph) findMaxMdsNode(nodes []string, mds []string) (string, int) {
 }
 
 func (g *Graph) MLST9(root string) (*Graph, []string) {
+	g = g.Snapshot()
 	visited := make(map[string]bool)
 	tree := make(map[string][]string)
 	var leaves []string
@@ -247,8 +252,11 @@ func (g *Graph) MLST9(root string) (*Graph, []string) {
 	return mlstree, leaves
 }
 
+// MLST10 builds the dissemination tree rooted at root. It works on a sorted
+// copy of g, so it is safe to call on a frozen snapshot.
 func (g *Graph) MLST10(root string) (*Graph, []string) {
-	g.Sotred()
+	g = g.Snapshot()
+	g = g.sortedCopy()
 	mlstree := NewGraph()
 	mlstree.root = root
 	var leaves []string
@@ -281,18 +289,24 @@ func (g *Graph) MLST10(root string) (*Graph, []string) {
 			}
 		}
 	}
-	mlstree.AddEdge(root, parent)
-	connected[parent] = true
-	mlstree.AddEdge(parent, nodeSelected)
-	connected[nodeSelected] = true
-	for _, l := range nodel {
-		mlstree.AddEdge(nodeSelected, l)
-		connected[l] = true
+	if nodeSelected != "" {
+		mlstree.AddEdge(root, parent)
+		connected[parent] = true
+		mlstree.AddEdge(parent, nodeSelected)
+		connected[nodeSelected] = true
+		for _, l := range nodel {
+			mlstree.AddEdge(nodeSelected, l)
+			connected[l] = true
+		}
 	}
 
-	for n, _ := range g.adjList {
+	// visit the rest in name order so every node builds the same tree
+	for _, n := range g.sortedVertices() {
 		if !connected[n] {
 			_, neigh := g.findMaxConnectedNeighbor(n, connected)
+			if neigh == "" {
+				continue
+			}
 			mlstree.AddEdge(neigh, n)
 			connected[neigh] = true
 		}
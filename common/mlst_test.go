@@ -0,0 +1,39 @@
+package common
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetSortedNodes(t *testing.T) {
+	g := graphOf("H-A H-B H-C A-B D-C")
+	// degrees: H 3, A 2, B 2, C 2, D 1, ties in name order
+	got := g.GetSortedNodes([]string{"D", "C", "B", "A", "H"})
+	if want := []string{"H", "A", "B", "C", "D"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted %v, want %v", got, want)
+	}
+}
+
+// Relays decide on trees they build independently, which only works when
+// every node builds the same tree from the same graph, however the graph
+// was learned.
+func TestMLST10Deterministic(t *testing.T) {
+	edges := strings.Fields("A-B B-C C-D B-E E-F C-F D-G G-H F-H A-I I-E")
+	rng := rand.New(rand.NewSource(1))
+	var want []Edge
+	for i := 0; i < 50; i++ {
+		rng.Shuffle(len(edges), func(i, j int) { edges[i], edges[j] = edges[j], edges[i] })
+		tree, _ := graphOf(strings.Join(edges, " ")).MLST10("A")
+		got := tree.Edges()
+		if want == nil {
+			want = got
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("tree %v differs from %v", got, want)
+		}
+	}
+	if n := len(want); n != 8 {
+		t.Errorf("tree over 9 vertices has %d edges", n)
+	}
+}
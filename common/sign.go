@@ -0,0 +1,37 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// signedContent is the part of a NodeMessage covered by its signature.
+func signedContent(m NodeMessage) []byte {
+	return []byte(m.NodeID + "|" + strconv.FormatInt(m.Incarnation, 10) + "|" +
+		strconv.Itoa(m.Revision) + "|" + strconv.FormatBool(m.Leave))
+}
+
+// SignMessage returns the HMAC-SHA256 of m under the shared cluster key.
+func SignMessage(key []byte, m NodeMessage) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signedContent(m))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyMessage checks the signature of m. Without a cluster key nothing can
+// be verified and every message is accepted, so leave notices are
+// unauthenticated and any host can forge one for any node.
+func VerifyMessage(key []byte, m NodeMessage) bool {
+	if len(key) == 0 {
+		return true
+	}
+	sig, err := hex.DecodeString(m.Signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signedContent(m))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package common
+
+import "sort"
+
+// SteinerTree approximates the minimum tree rooted at root that connects all
+// terminals, using the shortest path heuristic: starting from the root, the
+// terminal closest to the tree built so far is attached by a shortest path
+// until every reachable terminal is covered. Terminals that cannot be reached
+// from root are left out. Every leaf of the result is a terminal.
+func (g *Graph) SteinerTree(root string, terminals []string) *Graph {
+	g = g.Snapshot()
+	tree := NewGraph()
+	tree.root = root
+	inTree := map[string]bool{root: true}
+
+	remaining := make(map[string]bool)
+	for _, t := range terminals {
+		if t != root {
+			remaining[t] = true
+		}
+	}
+
+	for len(remaining) > 0 {
+		// multi-source BFS from every vertex already in the tree
+		parent := make(map[string]string)
+		var sources []string
+		for v := range inTree {
+			sources = append(sources, v)
+		}
+		sort.Strings(sources)
+		visited := make(map[string]bool)
+		queue := sources
+		for _, v := range sources {
+			visited[v] = true
+		}
+		found := ""
+		for len(queue) > 0 && found == "" {
+			node := queue[0]
+			queue = queue[1:]
+			for _, n := range g.sortedNeighbors(node) {
+				if visited[n] {
+					continue
+				}
+				visited[n] = true
+				parent[n] = node
+				if remaining[n] {
+					found = n
+					break
+				}
+				queue = append(queue, n)
+			}
+		}
+		if found == "" {
+			// the rest of the terminals are not connected to root
+			break
+		}
+		for v := found; !inTree[v]; v = parent[v] {
+			tree.AddEdge(parent[v], v)
+			inTree[v] = true
+			delete(remaining, v)
+		}
+	}
+	return tree
+}
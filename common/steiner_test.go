@@ -0,0 +1,56 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// graphOf builds a graph from edges written like "A-B B-C".
+func graphOf(edges string) *Graph {
+	g := NewGraph()
+	for _, e := range strings.Fields(edges) {
+		vs := strings.Split(e, "-")
+		g.AddEdge(vs[0], vs[1])
+	}
+	return g
+}
+
+// edgesOf returns the edges written like "A-B B-C" in order.
+func edgesOf(edges string) []Edge {
+	return graphOf(edges).Edges()
+}
+
+func TestSteinerTree(t *testing.T) {
+	tests := []struct {
+		name      string
+		graph     string
+		root      string
+		terminals []string
+		want      string
+	}{
+		{"path", "A-B B-C C-D", "A", []string{"D"}, "A-B B-C C-D"},
+		{"skips non-terminals", "A-H B-H C-H", "A", []string{"B"}, "A-H B-H"},
+		{"shares a path", "A-B B-C B-D A-E E-F", "A", []string{"C", "D"}, "A-B B-C B-D"},
+		{"shortest branch", "A-B B-C C-D A-E E-D", "A", []string{"C", "D"}, "A-B B-C C-D"},
+		{"root only", "A-B", "A", []string{"A"}, ""},
+		{"unreachable terminal", "A-B X-Y", "A", []string{"B", "Y"}, "A-B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := graphOf(tt.graph).SteinerTree(tt.root, tt.terminals)
+			if got, want := tree.Edges(), edgesOf(tt.want); !reflect.DeepEqual(got, want) {
+				t.Fatalf("edges %v, want %v", got, want)
+			}
+			terminal := map[string]bool{}
+			for _, v := range tt.terminals {
+				terminal[v] = true
+			}
+			for _, v := range tree.Vertices() {
+				if tree.IsLeaf(v) && !terminal[v] {
+					t.Errorf("leaf %s is not a terminal", v)
+				}
+			}
+		})
+	}
+}
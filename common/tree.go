@@ -0,0 +1,164 @@
+package common
+
+import "sort"
+
+// Tree builders that can be selected for dissemination.
+const (
+	// TreeMLST minimizes the number of relays, trees may get deep.
+	TreeMLST = "mlst"
+	// TreeSPT uses a shortest path tree, every node is reached in the
+	// minimal number of hops.
+	TreeSPT = "spt"
+	// TreeHybrid maximizes leaves while keeping the tree within a depth limit.
+	TreeHybrid = "hybrid"
+)
+
+// BuildTree builds the dissemination tree rooted at root with the builder
+// named by mode. maxDepth only applies to TreeHybrid. Unknown modes fall back
+// to the MLST.
+func (g *Graph) BuildTree(mode string, root string, maxDepth int) *Graph {
+	g = g.Snapshot()
+	switch mode {
+	case TreeSPT:
+		return g.ShortestPathTree(root)
+	case TreeHybrid:
+		return g.DepthBoundedMLST(root, maxDepth)
+	default:
+		tree, _ := g.MLST10(root)
+		return tree
+	}
+}
+
+// ShortestPathTree returns the BFS tree rooted at root. Neighbors are visited
+// in name order so every node computes the same tree from the same graph.
+func (g *Graph) ShortestPathTree(root string) *Graph {
+	g = g.Snapshot()
+	tree := NewGraph()
+	tree.root = root
+	visited := map[string]bool{root: true}
+	queue := []string{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, n := range g.sortedNeighbors(node) {
+			if !visited[n] {
+				visited[n] = true
+				tree.AddEdge(node, n)
+				queue = append(queue, n)
+			}
+		}
+	}
+	return tree
+}
+
+// DepthBoundedMLST greedily grows a tree with many leaves whose depth stays
+// within maxDepth. At every step the tree node that can adopt the most
+// unconnected neighbors becomes a relay and adopts all of them. A neighbor is
+// only adopted when that keeps it within maxDepth-ecc hops of its BFS depth,
+// where ecc is the depth of the shortest path tree; this guarantees that every
+// node can still be attached within the bound. A maxDepth below ecc is raised
+// to ecc, maxDepth <= 0 means no limit.
+func (g *Graph) DepthBoundedMLST(root string, maxDepth int) *Graph {
+	g = g.Snapshot()
+	tree := NewGraph()
+	tree.root = root
+
+	dist := g.distances(root)
+	slack := len(dist)
+	if maxDepth > 0 {
+		ecc := 0
+		for _, d := range dist {
+			ecc = max(ecc, d)
+		}
+		slack = max(0, maxDepth-ecc)
+	}
+
+	depth := map[string]int{root: 0}
+	members := []string{root}
+	adoptable := func(u string) []string {
+		var vs []string
+		for _, v := range g.sortedNeighbors(u) {
+			if _, in := depth[v]; !in && depth[u]+1 <= dist[v]+slack {
+				vs = append(vs, v)
+			}
+		}
+		return vs
+	}
+
+	for len(depth) < len(dist) {
+		var relay string
+		var best []string
+		for _, u := range members {
+			vs := adoptable(u)
+			if len(vs) > len(best) || (len(vs) == len(best) && len(vs) > 0 && depth[u] < depth[relay]) {
+				relay, best = u, vs
+			}
+		}
+		if len(best) == 0 {
+			break
+		}
+		for _, v := range best {
+			tree.AddEdge(relay, v)
+			depth[v] = depth[relay] + 1
+			members = append(members, v)
+		}
+		sort.Strings(members)
+	}
+	return tree
+}
+
+// TreeDepth returns the number of hops from the root to the deepest node.
+func (g *Graph) TreeDepth() int {
+	g = g.Snapshot()
+	depth := 0
+	for _, d := range g.distances(g.root) {
+		depth = max(depth, d)
+	}
+	return depth
+}
+
+// distances returns the hop count from root to every node reachable from it.
+func (g *Graph) distances(root string) map[string]int {
+	dist := map[string]int{root: 0}
+	queue := []string{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, n := range g.adjList[node] {
+			if _, ok := dist[n]; !ok {
+				dist[n] = dist[node] + 1
+				queue = append(queue, n)
+			}
+		}
+	}
+	return dist
+}
+
+func (g *Graph) sortedNeighbors(node string) []string {
+	ns := append([]string(nil), g.adjList[node]...)
+	sort.Strings(ns)
+	return ns
+}
+
+func (g *Graph) sortedVertices() []string {
+	vs := make([]string, 0, len(g.adjList))
+	for v := range g.adjList {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// LocalView returns the part of g that node learns from gossip: its own
+// links plus every link of its direct neighbors.
+func (g *Graph) LocalView(node string) *Graph {
+	g = g.Snapshot()
+	view := NewGraph()
+	for _, n := range g.adjList[node] {
+		view.AddEdge(node, n)
+		for _, nn := range g.adjList[n] {
+			view.AddEdge(n, nn)
+		}
+	}
+	return view
+}
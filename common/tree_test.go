@@ -0,0 +1,57 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func leaves(tree *Graph) int {
+	n := 0
+	for _, v := range tree.Vertices() {
+		if tree.IsLeaf(v) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDepthBoundedMLST(t *testing.T) {
+	// every leaf is two hops from R, the hub H relays to most of them but
+	// is itself two hops away
+	hub := "R-A A-H H-1 H-2 H-3 H-4 R-B R-C R-D B-1 C-2 D-3 B-4"
+	tests := []struct {
+		name      string
+		graph     string
+		maxDepth  int
+		wantDepth int
+		wantLeafs int
+	}{
+		{"path", "R-A A-B B-C", 0, 3, 1},
+		{"path below eccentricity", "R-A A-B B-C", 1, 3, 1},
+		{"star", "R-A R-B R-C", 1, 1, 3},
+		{"hub unbounded", hub, 0, 3, 6},
+		{"hub within bound", hub, 3, 3, 6},
+		{"hub too deep", hub, 2, 2, 5},
+		{"bound below eccentricity", hub, 1, 2, 5},
+		{"cycle", "R-A A-B B-C C-D D-R", 2, 2, 2},
+		{"cycle unbounded", "R-A A-B B-C C-D D-R", 0, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := graphOf(tt.graph)
+			tree := g.DepthBoundedMLST("R", tt.maxDepth)
+			if got, want := tree.Vertices(), g.Vertices(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("spans %v, want %v", got, want)
+			}
+			if n := len(tree.Edges()); n != len(g.Vertices())-1 {
+				t.Fatalf("%d edges for %d vertices", n, len(g.Vertices()))
+			}
+			if d := tree.TreeDepth(); d != tt.wantDepth {
+				t.Errorf("depth %d, want %d", d, tt.wantDepth)
+			}
+			if n := leaves(tree); n != tt.wantLeafs {
+				t.Errorf("%d leaves, want %d: %v", n, tt.wantLeafs, tree.Edges())
+			}
+		})
+	}
+}
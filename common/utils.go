@@ -1,9 +1,7 @@
 package common
 
 import (
-	"golang.org/x/exp/rand"
 	"reflect"
-	"strconv"
 )
 
 func IsStructEmpty(s interface{}) bool {
@@ -11,23 +9,6 @@ func IsStructEmpty(s interface{}) bool {
 	return reflect.DeepEqual(s, reflect.Zero(reflect.TypeOf(s)).Interface())
 }
 
-func GenerateNodeInfo() map[string]string {
-	cnum := rand.Intn(100)
-	cpu := "%" + strconv.Itoa(cnum)
-
-	mnum := rand.Intn(100)
-	mem := strconv.Itoa(mnum) + "MB"
-
-	bnum := rand.Intn(100)
-	ba := "%" + strconv.Itoa(bnum)
-
-	return map[string]string{
-		"Cpu":     cpu,
-		"Mem":     mem,
-		"Battery": ba,
-	}
-}
-
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// SchemaVersion is the payload schema written by this version. Receivers
+// keep values of kinds they do not know and relay them unchanged, so newer
+// senders can add kinds without breaking older nodes.
+const SchemaVersion = 1
+
+// Kind is the type of a Value.
+type Kind string
+
+const (
+	KindString Kind = "string"
+	KindNumber Kind = "number"
+	KindBool   Kind = "bool"
+	// KindBytes is a size in bytes.
+	KindBytes Kind = "bytes"
+)
+
+// Value is one typed entry of NodeMessage.Data. The value is kept in its
+// encoded form, which is what makes unknown kinds survive a relay.
+type Value struct {
+	Kind  Kind
+	Value json.RawMessage
+}
+
+// UnmarshalJSON also accepts the plain strings sent by builds before typed
+// values, schema 0, as string values.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = StringValue(s)
+		return nil
+	}
+	type value Value
+	var tv value
+	if err := json.Unmarshal(b, &tv); err != nil {
+		return err
+	}
+	*v = Value(tv)
+	return nil
+}
+
+func newValue(k Kind, v interface{}) Value {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// NaN and infinities have no JSON form
+		b = []byte("null")
+	}
+	return Value{Kind: k, Value: b}
+}
+
+func StringValue(s string) Value  { return newValue(KindString, s) }
+func NumberValue(n float64) Value { return newValue(KindNumber, n) }
+func BoolValue(b bool) Value      { return newValue(KindBool, b) }
+func BytesValue(n uint64) Value   { return newValue(KindBytes, n) }
+
+// Known reports whether the kind of v is understood by this version.
+func (v Value) Known() bool {
+	switch v.Kind {
+	case KindString, KindNumber, KindBool, KindBytes:
+		return true
+	}
+	return false
+}
+
+// Text returns the value of a string.
+func (v Value) Text() (string, bool) {
+	var s string
+	return s, v.Kind == KindString && json.Unmarshal(v.Value, &s) == nil
+}
+
+// Number returns the value of a number or of a size in bytes.
+func (v Value) Number() (float64, bool) {
+	var n float64
+	return n, (v.Kind == KindNumber || v.Kind == KindBytes) && json.Unmarshal(v.Value, &n) == nil
+}
+
+// Bool returns the value of a bool.
+func (v Value) Bool() (bool, bool) {
+	var b bool
+	return b, v.Kind == KindBool && json.Unmarshal(v.Value, &b) == nil
+}
+
+// Bytes returns the value of a size in bytes.
+func (v Value) Bytes() (uint64, bool) {
+	var n uint64
+	return n, v.Kind == KindBytes && json.Unmarshal(v.Value, &n) == nil
+}
+
+// Equal reports whether v and o are the same value.
+func (v Value) Equal(o Value) bool {
+	return v.Kind == o.Kind && bytes.Equal(v.Value, o.Value)
+}
+
+func (v Value) String() string {
+	switch v.Kind {
+	case KindString:
+		s, _ := v.Text()
+		return s
+	case KindBytes:
+		n, _ := v.Bytes()
+		return strconv.FormatUint(n, 10) + "B"
+	case KindNumber, KindBool:
+		return string(v.Value)
+	}
+	return string(v.Kind) + ":" + string(v.Value)
+}
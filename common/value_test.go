@@ -0,0 +1,134 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	data := map[string]Value{
+		"role":    StringValue("gateway"),
+		"battery": NumberValue(42.5),
+		"online":  BoolValue(true),
+		"free":    BytesValue(1 << 30),
+		"geo":     {Kind: "point", Value: json.RawMessage(`[1,2]`)},
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back map[string]Value
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range data {
+		if !back[k].Equal(v) {
+			t.Errorf("%s: got %v, want %v", k, back[k], v)
+		}
+	}
+	if s, ok := back["role"].Text(); !ok || s != "gateway" {
+		t.Errorf("Text() = %q %v", s, ok)
+	}
+	if n, ok := back["battery"].Number(); !ok || n != 42.5 {
+		t.Errorf("Number() = %v %v", n, ok)
+	}
+	if b, ok := back["online"].Bool(); !ok || !b {
+		t.Errorf("Bool() = %v %v", b, ok)
+	}
+	if n, ok := back["free"].Bytes(); !ok || n != 1<<30 {
+		t.Errorf("Bytes() = %v %v", n, ok)
+	}
+	if n, ok := back["free"].Number(); !ok || n != 1<<30 {
+		t.Errorf("Number() of bytes = %v %v", n, ok)
+	}
+	if back["geo"].Known() || !back["role"].Known() {
+		t.Errorf("Known() wrong for %v or %v", back["geo"], back["role"])
+	}
+	if _, ok := back["role"].Number(); ok {
+		t.Errorf("a string read as a number")
+	}
+}
+
+func TestValueLegacyString(t *testing.T) {
+	var msg NodeMessage
+	if err := json.Unmarshal([]byte(`{"NodeID":"B","Revision":3,"Data":{"Cpu":"%42","Mem":"17MB"}}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Schema != 0 {
+		t.Errorf("schema %d, want 0", msg.Schema)
+	}
+	if s, ok := msg.Data["Cpu"].Text(); !ok || s != "%42" {
+		t.Errorf("Cpu = %q %v, want string %%42", s, ok)
+	}
+}
+
+func TestValueNaN(t *testing.T) {
+	var nan float64
+	nan = nan / nan
+	if _, err := json.Marshal(NumberValue(nan)); err != nil {
+		t.Errorf("NaN value does not encode: %v", err)
+	}
+}
+
+// Messages as decoded by builds before typed values.
+type legacyNodeMessage struct {
+	NodeID   string
+	Revision int
+	Data     map[string]string
+}
+
+type legacyGossipMessage struct {
+	Self legacyNodeMessage
+	Msgs []struct {
+		PrevNode string
+		NodeMsg  legacyNodeMessage
+	}
+}
+
+func TestValueOlderReceiver(t *testing.T) {
+	self := NodeMessage{NodeID: "A", Revision: 2, Schema: SchemaVersion, Data: map[string]Value{
+		"role": StringValue("gateway"),
+		"cpu":  NumberValue(0.5),
+		"up":   BoolValue(true),
+		"free": BytesValue(2048),
+		"geo":  {Kind: "point", Value: json.RawMessage(`[1,2]`)},
+	}}
+	msg := GossipMessage{Self: self, Msgs: []SendMessage{{PrevNode: "B", NodeMsg: self}}}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var old legacyGossipMessage
+	if err := json.Unmarshal(b, &old); err != nil {
+		t.Fatalf("older receiver cannot decode: %v", err)
+	}
+	want := map[string]string{"role": "gateway", "cpu": "0.5", "up": "true", "free": "2048B", "geo": "point:[1,2]"}
+	for _, got := range []map[string]string{old.Self.Data, old.Msgs[0].NodeMsg.Data} {
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s = %q, want %q", k, got[k], v)
+			}
+		}
+	}
+
+	var back GossipMessage
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range self.Data {
+		if !back.Self.Data[k].Equal(v) || !back.Msgs[0].NodeMsg.Data[k].Equal(v) {
+			t.Errorf("%s: got %v, want %v", k, back.Self.Data[k], v)
+		}
+	}
+
+	// what an older node relays has the strings only
+	relayed, _ := json.Marshal(old.Self)
+	var fromOld NodeMessage
+	if err := json.Unmarshal(relayed, &fromOld); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := fromOld.Data["role"].Text(); !ok || s != "gateway" {
+		t.Errorf("role relayed by an older node = %q %v", s, ok)
+	}
+}
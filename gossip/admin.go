@@ -0,0 +1,75 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ServeAdmin serves the admin HTTP API on addr until the listener fails.
+func (a *Agent) ServeAdmin(addr string) {
+	fmt.Println(a.NodeId, " admin listen: ", addr)
+	if err := http.ListenAndServe(addr, a.adminHandler()); err != nil {
+		log.Printf("%s admin server stopped: %v", a.NodeId, err)
+	}
+}
+
+func (a *Agent) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/explain", a.handleExplain)
+	mux.HandleFunc("/members", a.handleMembers)
+	mux.HandleFunc("/seen", a.handleSeen)
+	mux.HandleFunc("/partitions", a.handlePartitions)
+	mux.HandleFunc("/cluster", a.handleCluster)
+	return mux
+}
+
+// handleExplain answers /explain?origin=<node>&revision=<n>.
+func (a *Agent) handleExplain(w http.ResponseWriter, r *http.Request) {
+	origin := r.URL.Query().Get("origin")
+	revision, err := strconv.Atoi(r.URL.Query().Get("revision"))
+	if origin == "" || err != nil {
+		http.Error(w, "origin and revision are required", http.StatusBadRequest)
+		return
+	}
+	exp, ok := a.ExplainForward(origin, revision)
+	if !ok {
+		http.Error(w, "no forwarding decision recorded", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, exp)
+}
+
+// handleMembers answers /members with the membership list.
+func (a *Agent) handleMembers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Members())
+}
+
+// handleSeen answers /seen with the duplicate suppression statistics.
+func (a *Agent) handleSeen(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Seen.Stats())
+}
+
+// handlePartitions answers /partitions with the detected partitions.
+func (a *Agent) handlePartitions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Partitions())
+}
+
+// handleCluster answers /cluster?filter=<expr> with the matching node states.
+func (a *Agent) handleCluster(w http.ResponseWriter, r *http.Request) {
+	states, err := a.FilterClusterState(r.URL.Query().Get("filter"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, states)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode admin response: %v", err)
+	}
+}
@@ -3,13 +3,17 @@ package gossip
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/collector"
 	"github.com/meixiezichuan/broadcast-gossip/common"
 	"log"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -20,40 +24,170 @@ type Path []string
 type HostMsg struct {
 	Msg       common.NodeMessage
 	SendPaths []Path
-}
-
-type NodeInfo struct {
-	Cpu     string
-	Battery string
-	Mem     string
+	// Route is the way the first copy of Msg came.
+	Route []string
+	// Round is when this version first arrived, Forwarded whether it has
+	// been relayed since. checkedView and checkedPaths describe the last
+	// decision, so it is only repeated when the topology or paths change.
+	Round        int
+	Forwarded    bool
+	checkedView  uint64
+	checkedPaths int
 }
 
 type Agent struct {
 	BroadcastAddr string
 	ListenAddr    string
 	NodeId        string
-	Revision      int
-	DB            *common.Database
-	NodeBuf       map[string]int
-	Msgs          map[string]HostMsg
-	Graph         *common.Graph
-	MsgCnt        int
+	// BootID numbers the boots of this node, it is sent as the Incarnation
+	// of its messages. Not to be confused with incarnation, the SWIM
+	// counter used to refute suspicions.
+	BootID int64
+	// Round counts gossip rounds, Revision is the version of this node's
+	// payload and only moves when the payload changes.
+	Round    int
+	Revision int
+	// DataDir holds the database and the message log of this node.
+	DataDir string
+	DB      *common.Database
+	NodeBuf map[string]common.Version
+	Msgs    map[string]HostMsg
+	Graph   *common.Graph
+	FD      *PhiDetector
+	Seen    *SeenCache
+	MsgCnt  int
+	Targets []string
+	// TreeMode and TreeMaxDepth choose how this node's own messages are
+	// disseminated, trading relay count against latency.
+	TreeMode     string
+	TreeMaxDepth int
+	// AdminAddr is the listen address of the admin HTTP API, empty disables it.
+	AdminAddr string
+	// Key is the shared cluster key signing leave notices. When empty leave
+	// notices are accepted unverified.
+	Key []byte
+	// DTNMode carries messages across partitions, see dtn.go.
+	DTNMode bool
+	// Collectors are read every round and merged into the state.
+	Collectors []collector.Collector
+	// EventHopLimit bounds how far published events travel, 0 means
+	// DefaultEventHopLimit.
+	EventHopLimit int
+
+	// mu serializes message handling with the per-round work.
+	mu       sync.Mutex
+	lastView *common.Graph
+	// store keeps the newest message of every origin, addrs the address
+	// every neighbor was last heard from. Broadcasts are sent from conn, the
+	// listening socket, so that address carries the neighbor's port.
+	store map[string]StoredMsg
+	addrs map[string]*net.UDPAddr
+	conn  *net.UDPConn
+	// NACK repair state, see nack.go
+	history  map[string][]common.NodeMessage
+	missing  map[string]*missingRevs
+	repairs  map[string]common.NodeMessage
+	repaired map[string]int
+	dtn      *DTNBuffer
+	state    map[string]common.Value
+	lastSelf *common.NodeMessage
+	explains map[string]ForwardExplanation
+
+	// partition detection, localSign counts down the rounds in which the
+	// last local sign of a split still counts
+	partitions []*Partition
+	silent     map[string]bool
+	heard      map[string]heard
+	lost       map[string]int
+	component  map[string]bool
+	localSign  int
+
+	// delta state, see delta.go
+	keyRevs    map[string]int
+	deleted    map[string]int
+	acked      map[string]common.Version
+	deltaFloor int
+
+	crdts     *common.CRDTState
+	crdtQueue map[string]int
+
+	// published events, see pubsub.go
+	events    map[string]*hostEvent
+	eventSeen *SeenCache
+	eventSeq  int
+	published []common.Event
+	eventSubs map[string][]chan common.Event
+
+	// queries, see query.go
+	queries        map[string]*hostQuery
+	pendingQueries map[string]*pendingQuery
+	askedQueries   []common.Query
+	responses      []common.Response
+	// SWIM membership, incarnation is this node's own incarnation number
+	incarnation int
+	members     map[string]*Member
+	memberQueue map[string]*queuedUpdate
+	evictions   []string
+	subMu       sync.Mutex
+	topoSubs    []chan TopologyEvent
+	stateSubs   []func(StateChange)
+	stateQueue  []StateChange
+	stateWake   chan struct{}
 }
 
-var TimeOutRev = 5
+// RoundInterval is the time between two gossip rounds.
+var RoundInterval = 5 * time.Second
+
+// RetainRounds is how many rounds a received message is kept. Until then a
+// message that could not be relayed is checked again whenever the topology
+// changes or it arrives on a new path.
+var RetainRounds = 3
 
-func InitAgent(nodeId string, port int) *Agent {
+// InitAgent creates the agent of node nodeId listening on port. Its
+// database and message log are kept in dir, the working directory if empty.
+func InitAgent(nodeId string, port int, dir string) *Agent {
 	agent := Agent{
 		BroadcastAddr: "255.255.255.255:" + strconv.Itoa(port),
 		ListenAddr:    ":" + strconv.Itoa(port),
 		NodeId:        nodeId,
 		Revision:      0,
-		DB:            InitDB(nodeId),
-		NodeBuf:       make(map[string]int),
+		DataDir:       dir,
+		DB:            InitDB(filepath.Join(dir, nodeId)),
+		NodeBuf:       make(map[string]common.Version),
 		Msgs:          make(map[string]HostMsg),
 		Graph:         common.NewGraph(),
+		FD:            NewPhiDetector(PhiThreshold, RoundInterval),
+		Seen:          NewSeenCache(SeenCacheSize, SeenCacheTTL),
 		MsgCnt:        0,
+		explains:      make(map[string]ForwardExplanation),
+		store:         make(map[string]StoredMsg),
+		addrs:         make(map[string]*net.UDPAddr),
+		history:       make(map[string][]common.NodeMessage),
+		missing:       make(map[string]*missingRevs),
+		repairs:       make(map[string]common.NodeMessage),
+		repaired:      make(map[string]int),
+		dtn:           NewDTNBuffer(DTNBufferSize),
+		silent:        make(map[string]bool),
+		heard:         make(map[string]heard),
+		lost:          make(map[string]int),
+		component:     make(map[string]bool),
+		keyRevs:       make(map[string]int),
+		deleted:       make(map[string]int),
+		acked:         make(map[string]common.Version),
+		crdts:         common.NewCRDTState(),
+		crdtQueue:     make(map[string]int),
+		events:        make(map[string]*hostEvent),
+		eventSeen:     NewSeenCache(SeenCacheSize, SeenCacheTTL),
+		eventSubs:     make(map[string][]chan common.Event),
+		queries:       make(map[string]*hostQuery),
+		members:       make(map[string]*Member),
+		memberQueue:   make(map[string]*queuedUpdate),
+	}
+	boot, err := agent.DB.NextBoot(time.Now().UnixNano())
+	if err != nil {
+		log.Fatalf("Failed to count boot: %v", err)
 	}
+	agent.BootID = boot
 	return &agent
 }
 
@@ -68,17 +202,17 @@ func InitDB(name string) *common.Database {
 // 生成Gossip消息
 func (a *Agent) generateGossipMessage() common.GossipMessage {
 	sendMsg := common.GossipMessage{}
-	self := common.NodeMessage{a.NodeId, a.Revision, map[string]string{}}
-	if a.Revision == 0 {
+	if a.Round == 0 {
 		sendMsg = a.Greeting()
 		return sendMsg
 	}
-	filename := a.NodeId
+	filename := filepath.Join(a.DataDir, a.NodeId)
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Println("Error opening or creating file:", err)
 	}
 
+	self := a.selfMessage()
 	msgWritten := self.NodeID + "_" + strconv.Itoa(self.Revision) + "\n"
 	_, err = file.WriteString(msgWritten)
 	if err != nil {
@@ -86,10 +220,13 @@ func (a *Agent) generateGossipMessage() common.GossipMessage {
 	}
 	//a.Write2DB(self)
 
-	self.Data = common.GenerateNodeInfo()
 	sendMsg.Self = self
 	var sendMsgs []common.SendMessage
+	// neighbors already listed as the PrevNode of a forwarded message, the
+	// others get an empty entry below so receivers see every live neighbor
 	var sendMsgNodeId []string
+	// decide every forward against the same frozen view of the topology
+	view := a.Graph.Snapshot()
 	for n, m := range a.Msgs {
 		//s := common.SendMessage{
 		//	PrevNode: n,
@@ -97,36 +234,40 @@ func (a *Agent) generateGossipMessage() common.GossipMessage {
 		//}
 		//sendMsgs = append(sendMsgs, s)
 		//a.Write2DB(m.Msg)
-		msgWritten = m.Msg.NodeID + "_" + strconv.Itoa(m.Msg.Revision) + "\n"
-		_, err = file.WriteString(msgWritten)
-		if err != nil {
-			fmt.Println("Error writing to file:", err)
+		if m.checkedPaths == 0 {
+			msgWritten = m.Msg.NodeID + "_" + strconv.Itoa(m.Msg.Revision) + "\n"
+			_, err = file.WriteString(msgWritten)
+			if err != nil {
+				fmt.Println("Error writing to file:", err)
+			}
 		}
-		paths := m.SendPaths
-		sort.Slice(paths, func(i, j int) bool {
-			return paths[i][0] < paths[j][0]
-		})
-		for _, p := range paths {
-			allP := append(p, a.NodeId)
-			if a.PathExistInMLST(allP) {
-				fmt.Println(a.NodeId, allP, "exists in mlst")
-				s := common.SendMessage{
-					PrevNode: p[len(p)-1],
-					NodeMsg:  m.Msg,
-				}
+		// keep undelivered messages, the tree may include this node later
+		if !m.Forwarded && (m.checkedView != view.Version() || m.checkedPaths != len(m.SendPaths)) {
+			if s, ok := a.decideForward(view, m); ok {
 				sendMsgs = append(sendMsgs, s)
-				sendMsgNodeId = append(sendMsgNodeId, m.Msg.NodeID)
-				break
+				sendMsgNodeId = append(sendMsgNodeId, s.PrevNode)
+				m.Forwarded = true
+				a.Seen.Add(n, m.Msg.Version(), time.Now())
+			}
+			m.checkedView = view.Version()
+			m.checkedPaths = len(m.SendPaths)
+			a.Msgs[n] = m
+		}
+		if a.Round-m.Round >= RetainRounds {
+			if !m.Forwarded {
+				fmt.Println(a.NodeId, " drop undelivered ", m.Msg.NodeID, "_", m.Msg.Revision)
 			}
+			a.Seen.Add(n, m.Msg.Version(), time.Now())
+			delete(a.Msgs, n)
 		}
-		delete(a.Msgs, n)
 	}
 	// Ensure the file is closed when done
 	file.Close()
 	// add adj information
-	for n, v := range a.NodeBuf {
+	now := time.Now()
+	for n := range a.NodeBuf {
 		// check if timeout
-		if a.Revision-v > TimeOutRev {
+		if !a.FD.Available(n, now) {
 			continue
 		}
 		if !common.Contains(sendMsgNodeId, n) {
@@ -138,28 +279,130 @@ func (a *Agent) generateGossipMessage() common.GossipMessage {
 		}
 	}
 	sendMsg.Msgs = sendMsgs
+	sendMsg.Members = a.memberUpdates()
+	sendMsg.Nacks = a.nacksToSend()
+	sendMsg.Repairs = a.repairsToSend()
+	sendMsg.Acks = a.acks(now)
+	sendMsg.CRDT, sendMsg.CRDTDigest = a.crdtToSend()
+	sendMsg.Events = a.eventsToSend(view)
+	sendMsg.Queries = a.queriesToSend(view)
+	sendMsg.Responses = a.responsesToSend()
 	return sendMsg
 }
 
-func (a *Agent) Start(stopCh chan bool, ep int) {
+// selfMessage builds this node's own message. The revision only moves
+// when the payload or the way it is disseminated differs from the message
+// sent before, otherwise relays would suppress the change as a duplicate.
+func (a *Agent) selfMessage() common.NodeMessage {
+	a.collectMetrics()
+	self := common.NodeMessage{
+		NodeID:      a.NodeId,
+		Incarnation: a.BootID,
+		Revision:    a.Revision,
+		Schema:      common.SchemaVersion,
+		Data:        a.stateCopy(),
+		Targets:     a.Targets,
+		TreeMode:    a.TreeMode,
+		TreeDepth:   a.TreeMaxDepth,
+	}
+	if a.lastSelf == nil || !sameContent(*a.lastSelf, self) {
+		a.Revision++
+		self.Revision = a.Revision
+		var old map[string]common.Value
+		if a.lastSelf != nil {
+			old = a.lastSelf.Data
+		}
+		a.trackKeys(old, self.Data)
+		a.lastSelf = &self
+	}
+	a.storeMsg(self)
+	return a.deltaMessage(self)
+}
+
+// sameContent reports whether m and o carry the same payload to the same
+// targets along the same kind of tree.
+func sameContent(m, o common.NodeMessage) bool {
+	return reflect.DeepEqual(m.Data, o.Data) &&
+		len(m.Targets) == len(o.Targets) && (len(m.Targets) == 0 || reflect.DeepEqual(m.Targets, o.Targets)) &&
+		m.TreeMode == o.TreeMode && m.TreeDepth == o.TreeDepth
+}
+
+// decideForward checks every path m arrived on against view and returns the
+// message to relay if one of them passes. The decision is recorded for
+// ExplainForward.
+func (a *Agent) decideForward(view *common.Graph, m HostMsg) (common.SendMessage, bool) {
+	var send common.SendMessage
+	paths := m.SendPaths
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i][0] < paths[j][0]
+	})
+	exp := ForwardExplanation{
+		Origin:   m.Msg.NodeID,
+		Revision: m.Msg.Revision,
+		Round:    a.Round,
+	}
+	for _, p := range paths {
+		allP := append(append(Path{}, p...), a.NodeId)
+		d := checkPath(a.NodeId, view, allP, m.Msg)
+		a.logDecision(d)
+		exp.Paths = append(exp.Paths, d)
+		if d.Passed && !exp.Forwarded {
+			fmt.Println(a.NodeId, allP, "exists in mlst")
+			exp.Forwarded = true
+			send = common.SendMessage{
+				PrevNode: p[len(p)-1],
+				NodeMsg:  m.Msg,
+				Route:    append(append([]string{}, m.Route...), a.NodeId),
+			}
+		}
+	}
+	a.recordExplanation(exp)
+	return send, exp.Forwarded
+}
+
+// Start runs the agent for ep rounds or until stopCh is closed, then
+// broadcasts a leave notice.
+func (a *Agent) Start(stopCh <-chan bool, ep int) {
 	addr, err := net.ResolveUDPAddr("udp", a.ListenAddr)
 	if err != nil {
 		log.Fatalf("Failed to resolve UDP address: %v", err)
 	}
 	fmt.Println(a.NodeId, " udpListen: ", addr)
+	if len(a.Key) == 0 {
+		log.Printf("%s WARNING: no GossipKey set, leave notices are not authenticated", a.NodeId)
+	}
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
 		log.Fatalf("%s Failed to listen on UDP: %v", a.NodeId, err)
 	}
+	a.conn = conn
 	defer func() {
 		conn.Close()
-		fmt.Println(a.NodeId, "Sent Message Count: ", a.MsgCnt, " in ", a.Revision, "epochs")
+		fmt.Println(a.NodeId, "Sent Message Count: ", a.MsgCnt, " in ", a.Round, "epochs")
 	}()
 
-	go a.ReceiveMsg(conn, stopCh)
+	if a.AdminAddr != "" {
+		go a.ServeAdmin(a.AdminAddr)
+	}
+	if AntiEntropyRounds > 0 || a.DTNMode {
+		ln, err := net.Listen("tcp", a.ListenAddr)
+		if err != nil {
+			log.Fatalf("%s Failed to listen on TCP: %v", a.NodeId, err)
+		}
+		defer ln.Close()
+		go a.ServeSync(ln)
+	}
+	// the receiver stops once the leave notice is out and conn is closed
+	quit := make(chan bool)
+	defer close(quit)
+	go a.ReceiveMsg(conn, quit)
 	t := rand.Intn(5)
-	time.Sleep(time.Duration(t) * time.Second)
-	a.BroadCast(stopCh, ep)
+	select {
+	case <-stopCh:
+	case <-time.After(time.Duration(t) * time.Second):
+		a.BroadCast(stopCh, ep)
+	}
+	a.Leave()
 }
 
 func (a *Agent) Greeting() common.GossipMessage {
@@ -173,10 +416,12 @@ func (a *Agent) Greeting() common.GossipMessage {
 
 	greeting := common.GossipMessage{
 		Self: common.NodeMessage{
-			NodeID:   a.NodeId,
-			Revision: a.Revision,
+			NodeID:      a.NodeId,
+			Incarnation: a.BootID,
+			Revision:    a.Revision,
 		},
-		Msgs: dMsgs,
+		Msgs:    dMsgs,
+		Members: a.memberUpdates(),
 	}
 	return greeting
 }
@@ -198,15 +443,19 @@ func (a *Agent) DoBroadCast(msg common.GossipMessage) {
 		return
 	}
 
-	conn, err := net.DialUDP("udp", nil, addr)
-	if err != nil {
-		fmt.Printf("%s Error dialing UDP: %v\n", a.NodeId, err)
-		return
-	}
-
 	bytes, err := json.Marshal(msg)
-	defer conn.Close()
-	_, err = conn.Write(bytes)
+	if a.conn != nil {
+		_, err = a.conn.WriteToUDP(bytes, addr)
+	} else {
+		var conn *net.UDPConn
+		conn, err = net.DialUDP("udp", nil, addr)
+		if err != nil {
+			fmt.Printf("%s Error dialing UDP: %v\n", a.NodeId, err)
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write(bytes)
+	}
 	if err != nil {
 		fmt.Printf("%s Error write UDP: %v\n", a.NodeId, err)
 		return
@@ -216,7 +465,7 @@ func (a *Agent) DoBroadCast(msg common.GossipMessage) {
 	fmt.Println(a.NodeId, "Send ", "msg: %v", msg)
 }
 
-func (a *Agent) BroadCast(stopCh chan bool, ep int) {
+func (a *Agent) BroadCast(stopCh <-chan bool, ep int) {
 	fmt.Println(a.NodeId, " BroadCast")
 	for {
 		select {
@@ -224,28 +473,35 @@ func (a *Agent) BroadCast(stopCh chan bool, ep int) {
 			fmt.Println("Received stop signal, stopping goroutine")
 			return
 		default:
-			if a.Revision == ep {
+			if a.Round == ep {
 				fmt.Println("********", a.NodeId, "ran ", ep, " epoch finished.", "********")
-				stopCh <- true
 				return
 			}
-			fmt.Println(a.NodeId, " in ", a.Revision, " graph1: ----")
-			a.Graph.Display()
+			a.mu.Lock()
 			a.UpdateGraph()
-			fmt.Println(a.NodeId, " in ", a.Revision, " graph2: ----")
-			a.Graph.Display()
+			a.updateMembers()
+			a.checkTopology()
+			a.checkPartition()
 			msg := a.generateGossipMessage()
+			a.evictMembers()
 			a.DoBroadCast(msg)
-			a.Revision++
-			time.Sleep(5 * time.Second)
+			a.Round++
+			a.dtn.Expire(time.Now())
+			if AntiEntropyRounds > 0 && a.Round%AntiEntropyRounds == 0 {
+				go a.antiEntropy()
+			}
+			a.mu.Unlock()
+			time.Sleep(RoundInterval)
 		}
 	}
 }
 
 func (a *Agent) UpdateGraph() {
 	fmt.Println(a.NodeId, " NodeBuf: ", a.NodeBuf)
-	for n, r := range a.NodeBuf {
-		if a.Revision-r > TimeOutRev {
+	now := time.Now()
+	for n := range a.NodeBuf {
+		if !a.FD.Available(n, now) {
+			fmt.Println(a.NodeId, " neighbor ", n, " timeout, phi: ", a.FD.Phi(n, now))
 			a.Graph.RemoveEdge(a.NodeId, n)
 		}
 	}
@@ -0,0 +1,47 @@
+package gossip
+
+import (
+	"testing"
+
+	"github.com/meixiezichuan/broadcast-gossip/common"
+)
+
+func TestSelfMessageRevision(t *testing.T) {
+	a := newTestAgent(t, "A")
+	a.SetState("role", common.StringValue("gateway"))
+	rev := a.selfMessage().Revision
+
+	steps := []struct {
+		name   string
+		change func()
+		bump   bool
+	}{
+		{"nothing", func() {}, false},
+		{"data", func() { a.SetState("role", common.StringValue("relay")) }, true},
+		{"targets", func() { a.Multicast([]string{"B", "C"}) }, true},
+		{"same targets", func() { a.Multicast([]string{"C", "B"}) }, false},
+		{"broadcast again", func() { a.Multicast(nil) }, true},
+		{"tree mode", func() { a.TreeMode = common.TreeSPT }, true},
+		{"tree depth", func() { a.TreeMaxDepth = 3 }, true},
+	}
+	for _, s := range steps {
+		s.change()
+		got := a.selfMessage().Revision
+		if bumped := got > rev; bumped != s.bump {
+			t.Errorf("%s: revision %d -> %d, want bump %v", s.name, rev, got, s.bump)
+		}
+		rev = got
+	}
+}
+
+func TestBootIDGrows(t *testing.T) {
+	a := newTestAgent(t, "A")
+	if a.BootID <= 0 {
+		t.Fatalf("boot ID %d", a.BootID)
+	}
+	// a restart on the same database, whatever the clock says
+	again := InitAgent("A", 0, a.DataDir)
+	if again.BootID != a.BootID+1 {
+		t.Errorf("boot ID after restart %d, want %d", again.BootID, a.BootID+1)
+	}
+}
@@ -0,0 +1,184 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+)
+
+// AntiEntropyRounds is the number of rounds between two push-pull syncs,
+// 0 disables anti-entropy.
+var AntiEntropyRounds = 3
+
+// syncTimeout bounds a whole push-pull exchange.
+var syncTimeout = 5 * time.Second
+
+// syncMessage is exchanged over TCP during anti-entropy. The initiator sends
+// its digest, the peer answers with its own digest plus the messages the
+// initiator lacks, and the initiator finally pushes what the peer lacks.
+// DTN encounters run the same exchange on the carried messages, using
+// Summary and Carried instead of Digest and Msgs.
+type syncMessage struct {
+	Kind    string
+	From    string
+	Digest  map[string]common.Version
+	Msgs    []common.NodeMessage
+	Summary []string
+	Carried []CarriedMsg
+	// CRDTDigest and CRDT do the same for the CRDT objects, see crdt.go.
+	CRDTDigest map[string]uint64
+	CRDT       *common.CRDTState
+}
+
+const syncDTN = "dtn"
+
+// ServeSync answers anti-entropy exchanges on ln until it is closed.
+func (a *Agent) ServeSync(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go a.handleSync(conn)
+	}
+}
+
+func (a *Agent) handleSync(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(syncTimeout))
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	var req syncMessage
+	if err := dec.Decode(&req); err != nil {
+		log.Printf("%s Failed to read sync request: %v", a.NodeId, err)
+		return
+	}
+	a.mu.Lock()
+	resp := syncMessage{Kind: req.Kind, From: a.NodeId}
+	if req.Kind == syncDTN {
+		resp.Summary = a.dtn.Summary()
+		resp.Carried = a.dtn.Missing(req.Summary, time.Now())
+	} else {
+		resp.Digest = a.digest()
+		resp.Msgs = a.missingFrom(req.Digest)
+		resp.CRDTDigest = a.crdts.Digest()
+		resp.CRDT = a.crdtCopy(req.CRDTDigest)
+	}
+	a.mu.Unlock()
+	if err := enc.Encode(resp); err != nil {
+		log.Printf("%s Failed to send sync response: %v", a.NodeId, err)
+		return
+	}
+
+	var push syncMessage
+	if err := dec.Decode(&push); err != nil {
+		log.Printf("%s Failed to read sync push: %v", a.NodeId, err)
+		return
+	}
+	a.acceptSynced(req.From, push.Msgs)
+	a.acceptCarried(req.From, push.Carried)
+	a.acceptCRDT(push.CRDT)
+}
+
+// antiEntropy runs one push-pull exchange with a random live neighbor.
+func (a *Agent) antiEntropy() {
+	a.mu.Lock()
+	peer, addr := a.syncPeer()
+	req := syncMessage{From: a.NodeId, Digest: a.digest(), CRDTDigest: a.crdts.Digest()}
+	a.mu.Unlock()
+	if peer == "" {
+		return
+	}
+	if err := a.syncWith(peer, addr, req); err != nil {
+		fmt.Println(a.NodeId, " anti-entropy with ", peer, " failed: ", err)
+	}
+}
+
+func (a *Agent) syncWith(peer, addr string, req syncMessage) error {
+	conn, err := net.DialTimeout("tcp", addr, syncTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(syncTimeout))
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	if err := enc.Encode(req); err != nil {
+		return err
+	}
+	var resp syncMessage
+	if err := dec.Decode(&resp); err != nil {
+		return err
+	}
+	a.acceptSynced(peer, resp.Msgs)
+	a.acceptCarried(peer, resp.Carried)
+	a.acceptCRDT(resp.CRDT)
+
+	a.mu.Lock()
+	push := syncMessage{Kind: req.Kind, From: a.NodeId}
+	if req.Kind == syncDTN {
+		push.Carried = a.dtn.Missing(resp.Summary, time.Now())
+	} else {
+		push.Msgs = a.missingFrom(resp.Digest)
+		push.CRDT = a.crdtCopy(resp.CRDTDigest)
+	}
+	a.mu.Unlock()
+	return enc.Encode(push)
+}
+
+// syncPeer picks a random neighbor the failure detector trusts and whose
+// address is known, and returns it with its sync address.
+func (a *Agent) syncPeer() (string, string) {
+	now := time.Now()
+	var peers []string
+	for n := range a.NodeBuf {
+		if _, known := a.addrs[n]; known && a.FD.Available(n, now) {
+			peers = append(peers, n)
+		}
+	}
+	if len(peers) == 0 {
+		return "", ""
+	}
+	sort.Strings(peers)
+	peer := peers[rand.Intn(len(peers))]
+	return peer, a.addrs[peer].String()
+}
+
+// acceptCRDT merges the CRDT objects pulled from or pushed by a peer.
+func (a *Agent) acceptCRDT(state *common.CRDTState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.mergeCRDT(state, nil)
+}
+
+// acceptSynced stores the messages pulled from or pushed by peer. They are
+// not relayed, every node repairs its own state through anti-entropy.
+func (a *Agent) acceptSynced(peer string, msgs []common.NodeMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, m := range msgs {
+		if m.NodeID == a.NodeId {
+			continue
+		}
+		if m.Leave {
+			if !common.VerifyMessage(a.Key, m) {
+				continue
+			}
+			a.markLeft(m.NodeID)
+		}
+		if a.storeMsg(m) {
+			n++
+		}
+	}
+	if n > 0 {
+		fmt.Println(a.NodeId, " anti-entropy with ", peer, " repaired ", n, " messages")
+	}
+}
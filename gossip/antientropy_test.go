@@ -0,0 +1,106 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMissingFrom(t *testing.T) {
+	a := newTestAgent(t, "X")
+	a.storeMsg(fullMsg("A", 3, "3"))
+	a.storeMsg(fullMsg("B", 2, "2"))
+	a.storeMsg(common.NodeMessage{NodeID: "C", Incarnation: 2, Revision: 1})
+
+	want := map[string]common.Version{"A": {Incarnation: 1, Revision: 3}, "B": {Incarnation: 1, Revision: 2}, "C": {Incarnation: 2, Revision: 1}}
+	if d := a.digest(); !reflect.DeepEqual(d, want) {
+		t.Fatalf("digest %v, want %v", d, want)
+	}
+
+	tests := []struct {
+		name   string
+		digest map[string]common.Version
+		want   []string
+	}{
+		{"empty peer", nil, []string{"A", "B", "C"}},
+		{"in sync", want, nil},
+		{"peer behind", map[string]common.Version{"A": {Incarnation: 1, Revision: 2}, "B": {Incarnation: 1, Revision: 2}, "C": {Incarnation: 2, Revision: 1}}, []string{"A"}},
+		{"peer ahead", map[string]common.Version{"A": {Incarnation: 1, Revision: 9}, "B": {Incarnation: 1, Revision: 2}, "C": {Incarnation: 2, Revision: 1}}, nil},
+		{"older boot", map[string]common.Version{"A": {Incarnation: 1, Revision: 3}, "B": {Incarnation: 1, Revision: 2}, "C": {Incarnation: 1, Revision: 7}}, []string{"C"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range a.missingFrom(tt.digest) {
+				got = append(got, m.NodeID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missing %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncPeerAddress(t *testing.T) {
+	a := newTestAgent(t, "A")
+	a.ListenAddr = ":9898"
+	b := newTestAgent(t, "B")
+	a.HandleMsg(b.generateGossipMessage())
+	// in a simulation every node listens on its own port of one host
+	a.recordAddr("B", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9899})
+	if peer, addr := a.syncPeer(); peer != "B" || addr != "127.0.0.1:9899" {
+		t.Errorf("sync peer %s at %s, want B at 127.0.0.1:9899", peer, addr)
+	}
+}
+
+func TestSyncWith(t *testing.T) {
+	a, b := newTestAgent(t, "A"), newTestAgent(t, "B")
+	a.storeMsg(fullMsg("X", 2, "a"))
+	a.storeMsg(fullMsg("Y", 1, "a"))
+	b.storeMsg(fullMsg("X", 1, "b"))
+	b.storeMsg(fullMsg("Y", 3, "b"))
+	b.storeMsg(fullMsg("Z", 1, "b"))
+	a.IncGCounter("hits", 2)
+	b.IncGCounter("hits", 3)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go b.ServeSync(ln)
+
+	req := syncMessage{From: a.NodeId, Digest: a.digest(), CRDTDigest: a.crdts.Digest()}
+	if err := a.syncWith("B", ln.Addr().String(), req); err != nil {
+		t.Fatal(err)
+	}
+	// the push is handled after the exchange returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		synced := reflect.DeepEqual(a.digest(), b.digest())
+		b.mu.Unlock()
+		if synced || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := map[string]common.Version{"X": {Incarnation: 1, Revision: 2}, "Y": {Incarnation: 1, Revision: 3}, "Z": {Incarnation: 1, Revision: 1}}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, x := range []*Agent{a, b} {
+		d := x.digest()
+		delete(d, x.NodeId)
+		if !reflect.DeepEqual(d, want) {
+			t.Errorf("%s holds %v, want %v", x.NodeId, d, want)
+		}
+		if v := x.crdts.GCounters["hits"].Value(); v != 5 {
+			t.Errorf("%s counts %d hits, want 5", x.NodeId, v)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"time"
+)
+
+// NodeState is the latest state known from one origin. Schema is the
+// SchemaVersion the origin runs, 0 for builds before typed values, and
+// Unknown lists the keys of Data whose kind this version does not know.
+// Path is the route the message took, from the origin to the neighbor it
+// was received from, and Hops its length. Both are empty for this node and
+// for states learned through repairs or anti-entropy.
+type NodeState struct {
+	Node        string
+	Incarnation int64
+	Revision    int
+	Schema      int
+	Data        map[string]common.Value
+	Unknown     []string
+	Received    time.Time
+	Hops        int
+	Path        []string
+}
+
+// ClusterState returns the latest state of every known origin, ordered by
+// node.
+func (a *Agent) ClusterState() []NodeState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.clusterState(nil)
+}
+
+// FilterClusterState returns the states whose data match the filter
+// expression, see common.ParseFilter.
+func (a *Agent) FilterClusterState(expr string) ([]NodeState, error) {
+	f, err := common.ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.clusterState(f), nil
+}
+
+func (a *Agent) clusterState(f common.Filter) []NodeState {
+	var states []NodeState
+	for n, s := range a.store {
+		if !f.Match(s.Msg.Data) {
+			continue
+		}
+		var unknown []string
+		for k, v := range s.Msg.Data {
+			if !v.Known() {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+		states = append(states, NodeState{
+			Node:        n,
+			Incarnation: s.Msg.Incarnation,
+			Revision:    s.Msg.Revision,
+			Schema:      s.Msg.Schema,
+			Data:        s.Msg.Data,
+			Unknown:     unknown,
+			Received:    s.Received,
+			Hops:        len(s.Route),
+			Path:        s.Route,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Node < states[j].Node
+	})
+	return states
+}
@@ -0,0 +1,38 @@
+package gossip
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/meixiezichuan/broadcast-gossip/common"
+)
+
+func TestClusterStateSchema(t *testing.T) {
+	a := newTestAgent(t, "A")
+	// a node of a build before typed values and one of a newer schema
+	for _, raw := range []string{
+		`{"Self":{"NodeID":"old","Revision":1,"Data":{"Cpu":"%42"}}}`,
+		`{"Self":{"NodeID":"new","Revision":1,"Schema":9,"Data":{"geo":{"Kind":"point","Value":[1,2]},"battery":{"Kind":"number","Value":10}}}}`,
+	} {
+		var msg common.GossipMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatal(err)
+		}
+		a.HandleMsg(msg)
+	}
+	states, err := a.FilterClusterState("battery < 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Node != "new" {
+		t.Fatalf("filter matched %v, want only new", states)
+	}
+	if states[0].Schema != 9 || !reflect.DeepEqual(states[0].Unknown, []string{"geo"}) {
+		t.Errorf("schema %d unknown %v, want 9 [geo]", states[0].Schema, states[0].Unknown)
+	}
+	old, _ := a.FilterClusterState(`Cpu == "%42"`)
+	if len(old) != 1 || old[0].Schema != 0 {
+		t.Errorf("old node state %v", old)
+	}
+}
@@ -0,0 +1,167 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The cluster-wide CRDTs. A changed object is piggybacked for a few rounds
+// like a membership change, and every message carries a digest of all
+// objects so neighbors send each other the ones they disagree on. At most
+// MaxCRDTBytes of objects go into one datagram, larger objects are only
+// exchanged by anti-entropy.
+
+// MaxCRDTBytes bounds the encoded CRDT objects sent in one gossip message.
+var MaxCRDTBytes = 8192
+
+// replica names this boot of the node in the CRDTs, so counts of an earlier
+// boot are never overwritten.
+func (a *Agent) replica() string {
+	return a.NodeId + "/" + strconv.FormatInt(a.BootID, 10)
+}
+
+// IncGCounter adds n to the grow-only counter called name.
+func (a *Agent) IncGCounter(name string, n uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.crdts.GCounter(name).Inc(a.replica(), n)
+	a.queueCRDT(common.GCounterKey(name))
+}
+
+func (a *Agent) GCounter(name string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.crdts.GCounters[name].Value()
+}
+
+// AddPNCounter adds delta, which may be negative, to the counter called name.
+func (a *Agent) AddPNCounter(name string, delta int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.crdts.PNCounter(name).Add(a.replica(), delta)
+	a.queueCRDT(common.PNCounterKey(name))
+}
+
+func (a *Agent) PNCounter(name string) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.crdts.PNCounters[name].Value()
+}
+
+// SetAdd adds elem to the set called name.
+func (a *Agent) SetAdd(name, elem string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.crdts.ORSet(name).Add(elem, a.replica())
+	a.queueCRDT(common.ORSetKey(name))
+}
+
+// SetRemove removes elem from the set called name. Adds of elem not yet
+// seen here survive.
+func (a *Agent) SetRemove(name, elem string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.crdts.ORSet(name).Remove(elem)
+	a.queueCRDT(common.ORSetKey(name))
+}
+
+func (a *Agent) SetElements(name string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s, exist := a.crdts.ORSets[name]; exist {
+		return s.Elements()
+	}
+	return nil
+}
+
+// SetRegister writes v to the last-writer-wins register called name.
+func (a *Agent) SetRegister(name string, v common.Value) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := time.Now().UnixNano()
+	// never go back behind the write being replaced
+	if cur, exist := a.crdts.Registers[name]; exist && cur.Time >= t {
+		t = cur.Time + 1
+	}
+	a.crdts.Registers[name] = common.LWWRegister{Value: v, Time: t, Replica: a.replica()}
+	a.queueCRDT(common.RegisterKey(name))
+}
+
+func (a *Agent) Register(name string) (common.Value, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, exist := a.crdts.Registers[name]
+	return r.Value, exist
+}
+
+// queueCRDT piggybacks the objects with the given keys for the next
+// rounds.
+func (a *Agent) queueCRDT(keys ...string) {
+	for _, k := range keys {
+		a.crdtQueue[k] = a.retransmits()
+	}
+}
+
+// mergeCRDT merges a received state and disseminates what changed here.
+// Objects the sender holds differently, according to its digest, are
+// sent back once.
+func (a *Agent) mergeCRDT(state *common.CRDTState, digest map[string]uint64) {
+	a.queueCRDT(a.crdts.Merge(state)...)
+	if digest == nil {
+		return
+	}
+	for _, k := range a.crdts.Differs(digest) {
+		if _, queued := a.crdtQueue[k]; !queued {
+			a.crdtQueue[k] = 1
+		}
+	}
+}
+
+// crdtToSend returns the queued objects that fit into MaxCRDTBytes and the
+// digest of all objects. Objects that do not fit stay queued.
+func (a *Agent) crdtToSend() (*common.CRDTState, map[string]uint64) {
+	keys := make([]string, 0, len(a.crdtQueue))
+	for k := range a.crdtQueue {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var send []string
+	size := 0
+	for _, k := range keys {
+		b, _ := json.Marshal(a.crdts.Select([]string{k}))
+		if len(b) > MaxCRDTBytes {
+			fmt.Println(a.NodeId, " crdt ", k, " is too large for gossip, left to anti-entropy")
+			delete(a.crdtQueue, k)
+			continue
+		}
+		if size+len(b) > MaxCRDTBytes {
+			continue
+		}
+		size += len(b)
+		send = append(send, k)
+		if a.crdtQueue[k]--; a.crdtQueue[k] <= 0 {
+			delete(a.crdtQueue, k)
+		}
+	}
+	var state *common.CRDTState
+	if len(send) > 0 {
+		state = a.crdts.Select(send)
+	}
+	return state, a.crdts.Digest()
+}
+
+// crdtCopy returns a copy of the objects of this node that differ from
+// digest, to be sent outside the agent lock.
+func (a *Agent) crdtCopy(digest map[string]uint64) *common.CRDTState {
+	b, err := json.Marshal(a.crdts.Select(a.crdts.Differs(digest)))
+	if err != nil {
+		return nil
+	}
+	c := common.NewCRDTState()
+	json.Unmarshal(b, c)
+	return c
+}
@@ -0,0 +1,92 @@
+package gossip
+
+import (
+	"encoding/json"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"reflect"
+	"testing"
+)
+
+// deliver hands the next gossip message of from to every agent of to,
+// encoded as on the wire, and returns its encoded CRDT objects.
+func deliver(t *testing.T, from *Agent, to ...*Agent) []byte {
+	t.Helper()
+	b, err := json.Marshal(from.generateGossipMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg common.GossipMessage
+	for _, x := range to {
+		msg = common.GossipMessage{}
+		if err := json.Unmarshal(b, &msg); err != nil {
+			t.Fatal(err)
+		}
+		x.HandleMsg(msg)
+	}
+	crdt, _ := json.Marshal(msg.CRDT)
+	return crdt
+}
+
+func TestCRDTConvergence(t *testing.T) {
+	a, b, c := newTestAgent(t, "A"), newTestAgent(t, "B"), newTestAgent(t, "C")
+	a.IncGCounter("hits", 2)
+	b.IncGCounter("hits", 3)
+	c.AddPNCounter("load", -4)
+	a.SetAdd("tags", "x")
+	c.SetAdd("tags", "y")
+	b.SetRegister("leader", common.StringValue("B"))
+
+	// A - B - C in a line
+	for i := 0; i < 10; i++ {
+		deliver(t, a, b)
+		deliver(t, b, a)
+		deliver(t, b, c)
+		deliver(t, c, b)
+	}
+	for _, x := range []*Agent{a, b, c} {
+		if !reflect.DeepEqual(x.crdts.Digest(), a.crdts.Digest()) {
+			t.Fatalf("%s diverges from A", x.NodeId)
+		}
+	}
+	if v := c.GCounter("hits"); v != 5 {
+		t.Errorf("hits = %d, want 5", v)
+	}
+	if v := a.PNCounter("load"); v != -4 {
+		t.Errorf("load = %d, want -4", v)
+	}
+	if e := a.SetElements("tags"); !reflect.DeepEqual(e, []string{"x", "y"}) {
+		t.Errorf("tags = %v", e)
+	}
+	if v, _ := c.Register("leader"); !v.Equal(common.StringValue("B")) {
+		t.Errorf("leader = %v", v)
+	}
+
+	// a remove spreads without leaving a tombstone
+	c.SetRemove("tags", "x")
+	for i := 0; i < 10; i++ {
+		deliver(t, c, b)
+		deliver(t, b, a)
+	}
+	if e := a.SetElements("tags"); !reflect.DeepEqual(e, []string{"y"}) {
+		t.Errorf("tags after remove = %v", e)
+	}
+}
+
+func TestCRDTBudget(t *testing.T) {
+	defer func(n int) { MaxCRDTBytes = n }(MaxCRDTBytes)
+	MaxCRDTBytes = 512
+
+	a, b := newTestAgent(t, "A"), newTestAgent(t, "B")
+	for i := 0; i < 100; i++ {
+		a.SetRegister(string(rune('a'+i%26))+string(rune('a'+i/26)), common.NumberValue(float64(i)))
+	}
+	for i := 0; i < 200 && !reflect.DeepEqual(a.crdts.Digest(), b.crdts.Digest()); i++ {
+		if crdt := deliver(t, a, b); len(crdt) > MaxCRDTBytes {
+			t.Fatalf("datagram carries %d bytes of CRDTs", len(crdt))
+		}
+		deliver(t, b, a)
+	}
+	if !reflect.DeepEqual(a.crdts.Digest(), b.crdts.Digest()) {
+		t.Fatalf("B holds %d of %d registers", len(b.crdts.Registers), len(a.crdts.Registers))
+	}
+}
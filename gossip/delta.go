@@ -0,0 +1,118 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"time"
+)
+
+// SnapshotRounds is how often the full state is sent even when every
+// neighbor could apply a delta. Deltas only go to the origin's neighbors,
+// relays pass on the merged full message, see UpdateMsgs.
+var SnapshotRounds = 10
+
+// trackKeys records the revision at which every key of the state last
+// changed, and when removed keys were deleted.
+func (a *Agent) trackKeys(old, cur map[string]common.Value) {
+	for k, v := range cur {
+		if o, exist := old[k]; !exist || !o.Equal(v) {
+			a.keyRevs[k] = a.Revision
+			delete(a.deleted, k)
+		}
+	}
+	for k := range old {
+		if _, exist := cur[k]; !exist {
+			delete(a.keyRevs, k)
+			a.deleted[k] = a.Revision
+		}
+	}
+}
+
+// acks returns the version stored for every live neighbor, telling it
+// which of its revisions its deltas can be based on.
+func (a *Agent) acks(now time.Time) map[string]common.Version {
+	acks := make(map[string]common.Version)
+	for n := range a.NodeBuf {
+		if s, exist := a.store[n]; exist && a.FD.Available(n, now) {
+			acks[n] = s.Msg.Version()
+		}
+	}
+	return acks
+}
+
+// deltaBase returns the oldest revision of this node acknowledged by a live
+// neighbor, or -1 when some neighbor has none of the current incarnation.
+func (a *Agent) deltaBase(now time.Time) int {
+	base := -1
+	for n := range a.NodeBuf {
+		if !a.FD.Available(n, now) {
+			continue
+		}
+		v, exist := a.acked[n]
+		if !exist || v.Incarnation != a.BootID {
+			return -1
+		}
+		if base < 0 || v.Revision < base {
+			base = v.Revision
+		}
+	}
+	return base
+}
+
+// deltaMessage turns full, this node's own message, into a delta holding the
+// keys changed since the revision all neighbors acknowledged. The full
+// message is sent every SnapshotRounds rounds, and when the base is unknown
+// or older than the deletions still remembered.
+func (a *Agent) deltaMessage(full common.NodeMessage) common.NodeMessage {
+	base := a.deltaBase(time.Now())
+	if a.Round%SnapshotRounds == 0 || base < 0 || base < a.deltaFloor {
+		return full
+	}
+	// every neighbor has seen these deletions
+	for k, r := range a.deleted {
+		if r <= base {
+			delete(a.deleted, k)
+		}
+	}
+	a.deltaFloor = base
+
+	delta := full
+	delta.Delta = true
+	delta.Base = base
+	delta.Data = make(map[string]common.Value)
+	for k, r := range a.keyRevs {
+		if r > base {
+			delta.Data[k] = full.Data[k]
+		}
+	}
+	for k := range a.deleted {
+		delta.Deleted = append(delta.Deleted, k)
+	}
+	sort.Strings(delta.Deleted)
+	return delta
+}
+
+// mergeDelta applies delta to the state stored for its origin and returns
+// the resulting full message. It fails when the stored state is older than
+// the base of the delta.
+func mergeDelta(old StoredMsg, exist bool, delta common.NodeMessage) (common.NodeMessage, bool) {
+	if !exist || old.Msg.Incarnation != delta.Incarnation || old.Msg.Revision < delta.Base {
+		return delta, false
+	}
+	data := make(map[string]common.Value, len(old.Msg.Data)+len(delta.Data))
+	for k, v := range old.Msg.Data {
+		data[k] = v
+	}
+	for k, v := range delta.Data {
+		data[k] = v
+	}
+	for _, k := range delta.Deleted {
+		delete(data, k)
+	}
+	full := delta
+	full.Delta = false
+	full.Base = 0
+	full.Deleted = nil
+	full.Data = data
+	return full, true
+}
@@ -0,0 +1,159 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"reflect"
+	"testing"
+)
+
+func TestMergeDelta(t *testing.T) {
+	old := StoredMsg{Msg: common.NodeMessage{NodeID: "A", Incarnation: 1, Revision: 5, Data: map[string]common.Value{
+		"a": common.StringValue("1"),
+		"b": common.StringValue("2"),
+		"c": common.StringValue("3"),
+	}}}
+	delta := common.NodeMessage{NodeID: "A", Incarnation: 1, Revision: 7, Delta: true, Base: 4,
+		Data:    map[string]common.Value{"b": common.StringValue("20"), "d": common.StringValue("4")},
+		Deleted: []string{"c"},
+	}
+	tests := []struct {
+		name  string
+		old   StoredMsg
+		exist bool
+		delta func(common.NodeMessage) common.NodeMessage
+		ok    bool
+	}{
+		{"applies", old, true, func(d common.NodeMessage) common.NodeMessage { return d }, true},
+		{"at base", old, true, func(d common.NodeMessage) common.NodeMessage { d.Base = 5; return d }, true},
+		{"nothing stored", StoredMsg{}, false, func(d common.NodeMessage) common.NodeMessage { return d }, false},
+		{"behind base", old, true, func(d common.NodeMessage) common.NodeMessage { d.Base = 6; return d }, false},
+		{"other boot", old, true, func(d common.NodeMessage) common.NodeMessage { d.Incarnation = 2; return d }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full, ok := mergeDelta(tt.old, tt.exist, tt.delta(delta))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			want := map[string]common.Value{"a": common.StringValue("1"), "b": common.StringValue("20"), "d": common.StringValue("4")}
+			if !reflect.DeepEqual(full.Data, want) || full.Delta || full.Deleted != nil || full.Revision != 7 {
+				t.Errorf("merged %+v", full)
+			}
+		})
+	}
+	if len(old.Msg.Data) != 3 {
+		t.Errorf("merge changed the stored state")
+	}
+}
+
+func TestDeltaMessage(t *testing.T) {
+	a := newTestAgent(t, "A")
+	a.SetState("a", common.StringValue("1"))
+	a.SetState("b", common.StringValue("2"))
+	first := a.selfMessage()
+	if first.Delta {
+		t.Fatalf("delta before any neighbor acknowledged")
+	}
+
+	// B heard about A and acknowledges its revision
+	b := newTestAgent(t, "B")
+	a.HandleMsg(b.generateGossipMessage())
+	a.acked["B"] = first.Version()
+
+	a.SetState("b", common.StringValue("20"))
+	a.DeleteState("a")
+	a.SetState("c", common.StringValue("3"))
+	d := a.selfMessage()
+	if !d.Delta || d.Base != first.Revision {
+		t.Fatalf("got delta %v on base %d, want a delta on %d", d.Delta, d.Base, first.Revision)
+	}
+	want := map[string]common.Value{"b": common.StringValue("20"), "c": common.StringValue("3")}
+	if !reflect.DeepEqual(d.Data, want) || !reflect.DeepEqual(d.Deleted, []string{"a"}) {
+		t.Errorf("delta data %v deleted %v", d.Data, d.Deleted)
+	}
+
+	// once B acknowledged the deletion it is not sent again
+	a.acked["B"] = d.Version()
+	a.SetState("c", common.StringValue("30"))
+	d = a.selfMessage()
+	if !d.Delta || len(d.Deleted) != 0 || !reflect.DeepEqual(d.Data, map[string]common.Value{"c": common.StringValue("30")}) {
+		t.Errorf("second delta %+v", d)
+	}
+
+	// a snapshot round sends the full state
+	a.Round = SnapshotRounds
+	a.SetState("c", common.StringValue("300"))
+	if d := a.selfMessage(); d.Delta || len(d.Data) != 2 {
+		t.Errorf("snapshot round sent %+v", d)
+	}
+}
+
+// exchange lets every agent of a line gossip to its neighbors once and
+// starts the next round.
+func exchange(t *testing.T, line []*Agent) {
+	t.Helper()
+	for i, x := range line {
+		var neighbors []*Agent
+		if i > 0 {
+			neighbors = append(neighbors, line[i-1])
+		}
+		if i+1 < len(line) {
+			neighbors = append(neighbors, line[i+1])
+		}
+		deliver(t, x, neighbors...)
+	}
+	for _, x := range line {
+		x.Round++
+	}
+}
+
+func TestDeltaMultiHop(t *testing.T) {
+	defer func(n int) { SnapshotRounds = n }(SnapshotRounds)
+	SnapshotRounds = 1000
+
+	a, b, c, d := newTestAgent(t, "A"), newTestAgent(t, "B"), newTestAgent(t, "C"), newTestAgent(t, "D")
+	line := []*Agent{a, b, c, d}
+	a.SetState("keep", common.StringValue("1"))
+	a.SetState("drop", common.StringValue("2"))
+	for i := 0; i < 8; i++ {
+		exchange(t, line)
+	}
+	if _, exist := d.GetState("A", "drop"); !exist {
+		t.Fatalf("D never got the state of A")
+	}
+
+	// C misses a revision B already acknowledged to A
+	a.SetState("keep", common.StringValue("10"))
+	deliver(t, a, b)
+	deliver(t, b, a)
+	deliver(t, c, b, d)
+	deliver(t, d, c)
+	for _, x := range line {
+		x.Round++
+	}
+
+	// so the next delta of A is based on a revision C does not hold
+	a.DeleteState("drop")
+	a.SetState("new", common.StringValue("3"))
+	exchange(t, line)
+	if s := b.store["A"]; s.Msg.Revision != a.Revision {
+		t.Fatalf("B holds revision %d of A, want %d", s.Msg.Revision, a.Revision)
+	}
+	for _, x := range []*Agent{b, c, d} {
+		if v, _ := x.GetState("A", "keep"); !v.Equal(common.StringValue("10")) {
+			t.Errorf("%s: keep = %v", x.NodeId, v)
+		}
+		if v, _ := x.GetState("A", "new"); !v.Equal(common.StringValue("3")) {
+			t.Errorf("%s: new = %v", x.NodeId, v)
+		}
+		if _, exist := x.GetState("A", "drop"); exist {
+			t.Errorf("%s still has the deleted key", x.NodeId)
+		}
+		if m, exist := x.missing["A"]; exist && len(m.revs) > 0 {
+			t.Errorf("%s NACKs revisions %v of A", x.NodeId, m.revs)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"time"
+)
+
+// Epidemic DTN limits: every buffered message lives DTNTTL from the moment
+// it is first buffered, and at most DTNBufferSize messages are carried.
+var (
+	DTNBufferSize = 256
+	DTNTTL        = 30 * time.Minute
+)
+
+// CarriedMsg is a buffered message handed over between encounters together
+// with the time it has left to live.
+type CarriedMsg struct {
+	Msg common.NodeMessage
+	TTL time.Duration
+}
+
+type dtnEntry struct {
+	msg     common.NodeMessage
+	expires time.Time
+}
+
+// DTNBuffer carries messages across partitions. When two nodes meet they
+// swap summary vectors, the keys of the messages they carry, and hand over
+// whatever the other one lacks.
+type DTNBuffer struct {
+	capacity int
+	entries  map[string]*dtnEntry
+}
+
+func NewDTNBuffer(capacity int) *DTNBuffer {
+	return &DTNBuffer{
+		capacity: capacity,
+		entries:  make(map[string]*dtnEntry),
+	}
+}
+
+// Add buffers msg for ttl. When the buffer is full the message closest to
+// expiry makes room, unless msg itself would expire first.
+func (b *DTNBuffer) Add(msg common.NodeMessage, ttl time.Duration, now time.Time) {
+	key := repairKey(msg)
+	if _, exist := b.entries[key]; exist || ttl <= 0 {
+		return
+	}
+	expires := now.Add(ttl)
+	if len(b.entries) >= b.capacity {
+		var oldest string
+		for k, e := range b.entries {
+			if oldest == "" || e.expires.Before(b.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		if oldest == "" || expires.Before(b.entries[oldest].expires) {
+			return
+		}
+		delete(b.entries, oldest)
+	}
+	b.entries[key] = &dtnEntry{msg: msg, expires: expires}
+}
+
+// Expire drops every message whose TTL ran out.
+func (b *DTNBuffer) Expire(now time.Time) {
+	for k, e := range b.entries {
+		if !now.Before(e.expires) {
+			delete(b.entries, k)
+		}
+	}
+}
+
+// Summary returns the summary vector of the buffer.
+func (b *DTNBuffer) Summary() []string {
+	keys := make([]string, 0, len(b.entries))
+	for k := range b.entries {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Missing returns the buffered messages absent from summary.
+func (b *DTNBuffer) Missing(summary []string, now time.Time) []CarriedMsg {
+	has := make(map[string]bool, len(summary))
+	for _, k := range summary {
+		has[k] = true
+	}
+	var msgs []CarriedMsg
+	for k, e := range b.entries {
+		if !has[k] && now.Before(e.expires) {
+			msgs = append(msgs, CarriedMsg{Msg: e.msg, TTL: e.expires.Sub(now)})
+		}
+	}
+	return msgs
+}
+
+// carry buffers msg when DTN mode is on.
+func (a *Agent) carry(msg common.NodeMessage) {
+	if a.DTNMode {
+		a.dtn.Add(msg, DTNTTL, time.Now())
+	}
+}
+
+// encounter hands over carried messages to a node that just became a neighbor.
+func (a *Agent) encounter(peer string) {
+	a.mu.Lock()
+	addr, known := a.addrs[peer]
+	req := syncMessage{Kind: syncDTN, From: a.NodeId, Summary: a.dtn.Summary()}
+	a.mu.Unlock()
+	if !known {
+		return
+	}
+	if err := a.syncWith(peer, addr.String(), req); err != nil {
+		fmt.Println(a.NodeId, " dtn exchange with ", peer, " failed: ", err)
+	}
+}
+
+// acceptCarried buffers the messages handed over by peer and merges them
+// into the local state.
+func (a *Agent) acceptCarried(peer string, carried []CarriedMsg) {
+	if len(carried) == 0 {
+		return
+	}
+	msgs := make([]common.NodeMessage, 0, len(carried))
+	a.mu.Lock()
+	now := time.Now()
+	for _, c := range carried {
+		a.dtn.Add(c.Msg, c.TTL, now)
+		msgs = append(msgs, c.Msg)
+	}
+	a.mu.Unlock()
+	fmt.Println(a.NodeId, " dtn received ", len(carried), " messages from ", peer)
+	a.acceptSynced(peer, msgs)
+}
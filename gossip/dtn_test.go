@@ -0,0 +1,131 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type dtnAdd struct {
+	origin string
+	rev    int
+	ttl    time.Duration
+}
+
+func (d dtnAdd) msg() common.NodeMessage {
+	return fullMsg(d.origin, d.rev, "v")
+}
+
+func bufferKeys(b *DTNBuffer) []string {
+	keys := b.Summary()
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDTNBufferAdd(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		capacity int
+		before   []dtnAdd
+		add      dtnAdd
+		want     []string
+	}{
+		{"room left", 2, []dtnAdd{{"A", 1, 10 * time.Minute}}, dtnAdd{"B", 1, 5 * time.Minute},
+			[]string{"A_1_1", "B_1_1"}},
+		{"evicts closest to expiry", 2, []dtnAdd{{"A", 1, 10 * time.Minute}, {"B", 1, 5 * time.Minute}},
+			dtnAdd{"C", 1, 20 * time.Minute}, []string{"A_1_1", "C_1_1"}},
+		{"full and expires first", 2, []dtnAdd{{"A", 1, 10 * time.Minute}, {"B", 1, 5 * time.Minute}},
+			dtnAdd{"C", 1, time.Minute}, []string{"A_1_1", "B_1_1"}},
+		{"duplicate", 2, []dtnAdd{{"A", 1, 10 * time.Minute}}, dtnAdd{"A", 1, 20 * time.Minute},
+			[]string{"A_1_1"}},
+		{"revisions are separate", 2, []dtnAdd{{"A", 1, 10 * time.Minute}}, dtnAdd{"A", 2, 10 * time.Minute},
+			[]string{"A_1_1", "A_1_2"}},
+		{"no ttl left", 2, nil, dtnAdd{"A", 1, 0}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewDTNBuffer(tt.capacity)
+			for _, d := range tt.before {
+				b.Add(d.msg(), d.ttl, now)
+			}
+			b.Add(tt.add.msg(), tt.add.ttl, now)
+			if got := bufferKeys(b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buffer holds %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a duplicate does not extend the TTL of the buffered copy
+	b := NewDTNBuffer(2)
+	b.Add(fullMsg("A", 1, "v"), time.Minute, now)
+	b.Add(fullMsg("A", 1, "v"), time.Hour, now)
+	if ms := b.Missing(nil, now); len(ms) != 1 || ms[0].TTL != time.Minute {
+		t.Errorf("duplicate changed the TTL: %+v", ms)
+	}
+}
+
+func TestDTNBufferExpire(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name string
+		at   time.Duration
+		want []string
+	}{
+		{"fresh", 0, []string{"A_1_1", "B_1_1", "C_1_1"}},
+		{"just before", time.Minute - time.Second, []string{"A_1_1", "B_1_1", "C_1_1"}},
+		{"at expiry", time.Minute, []string{"B_1_1", "C_1_1"}},
+		{"later", 7 * time.Minute, []string{"C_1_1"}},
+		{"all gone", 10 * time.Minute, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewDTNBuffer(10)
+			b.Add(fullMsg("A", 1, "v"), time.Minute, start)
+			b.Add(fullMsg("B", 1, "v"), 5*time.Minute, start)
+			b.Add(fullMsg("C", 1, "v"), 10*time.Minute, start)
+			b.Expire(start.Add(tt.at))
+			if got := bufferKeys(b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buffer holds %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDTNBufferMissing(t *testing.T) {
+	start := time.Now()
+	b := NewDTNBuffer(10)
+	b.Add(fullMsg("A", 1, "v"), time.Minute, start)
+	b.Add(fullMsg("B", 1, "v"), 5*time.Minute, start)
+	b.Add(fullMsg("C", 1, "v"), 10*time.Minute, start)
+
+	tests := []struct {
+		name    string
+		summary []string
+		at      time.Duration
+		want    map[string]time.Duration
+	}{
+		{"empty summary", nil, 0,
+			map[string]time.Duration{"A": time.Minute, "B": 5 * time.Minute, "C": 10 * time.Minute}},
+		{"peer has some", []string{"A_1_1", "C_1_1"}, 0,
+			map[string]time.Duration{"B": 5 * time.Minute}},
+		{"peer has all", []string{"A_1_1", "B_1_1", "C_1_1"}, 0, map[string]time.Duration{}},
+		{"other revision", []string{"B_1_2"}, 0,
+			map[string]time.Duration{"A": time.Minute, "B": 5 * time.Minute, "C": 10 * time.Minute}},
+		{"remaining ttl", []string{"C_1_1"}, 2 * time.Minute,
+			map[string]time.Duration{"B": 3 * time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]time.Duration)
+			for _, c := range b.Missing(tt.summary, start.Add(tt.at)) {
+				got[c.Msg.NodeID] = c.TTL
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missing %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+)
+
+type TopologyEventType string
+
+const (
+	EventNeighborUp         TopologyEventType = "neighbor-up"
+	EventNeighborDown       TopologyEventType = "neighbor-down"
+	EventEdgeUp             TopologyEventType = "2hop-edge-up"
+	EventEdgeDown           TopologyEventType = "2hop-edge-down"
+	EventPartitionSuspected TopologyEventType = "partition-suspected"
+	EventNodeRestarted      TopologyEventType = "node-restarted"
+	EventPartitionHealed    TopologyEventType = "partition-healed"
+)
+
+// TopologyEvent describes one change of the agent's view of the network.
+// Node is set for neighbor and restart events, Edge for 2-hop edge events
+// and Nodes lists the nodes involved in partition events.
+type TopologyEvent struct {
+	Type  TopologyEventType
+	Round int
+	Node  string
+	Edge  common.Edge
+	Nodes []string
+}
+
+// topologyBufSize is the capacity of every subscriber channel. Events are
+// dropped for subscribers that fall this far behind.
+var topologyBufSize = 64
+
+// SubscribeTopology returns a channel receiving every topology event
+// published after the call.
+func (a *Agent) SubscribeTopology() <-chan TopologyEvent {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	ch := make(chan TopologyEvent, topologyBufSize)
+	a.topoSubs = append(a.topoSubs, ch)
+	return ch
+}
+
+// UnsubscribeTopology stops delivering events to ch and closes it.
+func (a *Agent) UnsubscribeTopology(ch <-chan TopologyEvent) {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	for i, c := range a.topoSubs {
+		if c == ch {
+			a.topoSubs = append(a.topoSubs[:i], a.topoSubs[i+1:]...)
+			close(c)
+			return
+		}
+	}
+}
+
+func (a *Agent) publishTopology(ev TopologyEvent) {
+	fmt.Println(a.NodeId, "topology event:", ev)
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	for _, c := range a.topoSubs {
+		select {
+		case c <- ev:
+		default:
+		}
+	}
+}
+
+// checkTopology compares the current graph with the view seen in the
+// previous round and publishes an event for every change.
+func (a *Agent) checkTopology() {
+	cur := a.Graph.Snapshot()
+	prev := a.lastView
+	a.lastView = cur
+	if prev == nil {
+		prev = common.NewGraph()
+	}
+	diff := prev.Diff(cur)
+	if diff.Empty() {
+		return
+	}
+	fmt.Println(a.NodeId, " in ", a.Round, " graph diff: ", diff)
+	for _, ev := range topologyEvents(a.NodeId, a.Round, prev, cur, diff) {
+		a.publishTopology(ev)
+		if ev.Type == EventNeighborUp && a.DTNMode {
+			go a.encounter(ev.Node)
+		}
+	}
+}
+
+// topologyEvents classifies a diff seen from node self. Edges touching self
+// are neighbor changes, all others are 2-hop edges. Vertices that were
+// reachable from self before but are not any more suggest a partition.
+func topologyEvents(self string, round int, prev, cur *common.Graph, diff common.GraphDiff) []TopologyEvent {
+	var evs []TopologyEvent
+	for _, e := range diff.AddedEdges {
+		if e.Has(self) {
+			evs = append(evs, TopologyEvent{Type: EventNeighborUp, Round: round, Node: e.Other(self)})
+		} else {
+			evs = append(evs, TopologyEvent{Type: EventEdgeUp, Round: round, Edge: e})
+		}
+	}
+	for _, e := range diff.RemovedEdges {
+		if e.Has(self) {
+			evs = append(evs, TopologyEvent{Type: EventNeighborDown, Round: round, Node: e.Other(self)})
+		} else {
+			evs = append(evs, TopologyEvent{Type: EventEdgeDown, Round: round, Edge: e})
+		}
+	}
+
+	if len(diff.RemovedEdges) == 0 {
+		return evs
+	}
+	now := make(map[string]bool)
+	for _, v := range cur.Reachable(self) {
+		now[v] = true
+	}
+	var lost []string
+	for _, v := range prev.Reachable(self) {
+		if v != self && !now[v] {
+			lost = append(lost, v)
+		}
+	}
+	if len(lost) > 0 {
+		evs = append(evs, TopologyEvent{Type: EventPartitionSuspected, Round: round, Nodes: lost})
+	}
+	return evs
+}
@@ -0,0 +1,77 @@
+package gossip
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/meixiezichuan/broadcast-gossip/common"
+)
+
+func TestTopologyEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur string
+		want      []TopologyEvent
+	}{
+		{"nothing", "A-B B-C", "A-B B-C", nil},
+		{"neighbor up", "A-B", "A-B A-C", []TopologyEvent{
+			{Type: EventNeighborUp, Node: "C"},
+		}},
+		{"neighbor down", "A-B B-C A-C", "A-B B-C", []TopologyEvent{
+			{Type: EventNeighborDown, Node: "C"},
+		}},
+		{"2-hop edge up", "A-B A-C", "A-B A-C B-C", []TopologyEvent{
+			{Type: EventEdgeUp, Edge: common.NewEdge("B", "C")},
+		}},
+		{"2-hop edge down", "A-B A-C B-C", "A-B A-C", []TopologyEvent{
+			{Type: EventEdgeDown, Edge: common.NewEdge("B", "C")},
+		}},
+		{"component lost", "A-B B-C C-D", "A-B C-D", []TopologyEvent{
+			{Type: EventEdgeDown, Edge: common.NewEdge("B", "C")},
+			{Type: EventPartitionSuspected, Nodes: []string{"C", "D"}},
+		}},
+		{"last neighbor lost", "A-B B-C", "B-C", []TopologyEvent{
+			{Type: EventNeighborDown, Node: "B"},
+			{Type: EventPartitionSuspected, Nodes: []string{"B", "C"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev, cur := topology(tt.prev), topology(tt.cur)
+			got := topologyEvents("A", 0, prev, cur, prev.Diff(cur))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnreportedEdgeDropped(t *testing.T) {
+	a, b := newTestAgent(t, "A"), newTestAgent(t, "B")
+	events := a.SubscribeTopology()
+
+	msg := b.generateGossipMessage()
+	msg.Msgs = append(msg.Msgs, common.SendMessage{PrevNode: "C"})
+	a.HandleMsg(msg)
+	a.checkTopology()
+	if !a.Graph.PathExists([]string{"B", "C"}) {
+		t.Fatal("edge B-C not added")
+	}
+
+	// B no longer lists C among its neighbors
+	b.Round++
+	a.Round++
+	a.HandleMsg(b.generateGossipMessage())
+	a.checkTopology()
+	if a.Graph.PathExists([]string{"B", "C"}) {
+		t.Fatal("edge B-C kept after B stopped reporting it")
+	}
+	var down bool
+	for len(events) > 0 {
+		ev := <-events
+		down = down || ev.Type == EventEdgeDown && ev.Edge == common.NewEdge("B", "C")
+	}
+	if !down {
+		t.Error("no 2-hop edge down event for B-C")
+	}
+}
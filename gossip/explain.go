@@ -0,0 +1,52 @@
+package gossip
+
+import "strconv"
+
+// ExplainRounds is how many rounds forwarding decisions are kept for ExplainForward.
+var ExplainRounds = 20
+
+// PathDecision records how one candidate path of a message was judged.
+type PathDecision struct {
+	Path   Path
+	Root   string
+	Mode   string
+	Tree   map[string][]string
+	Leaf   bool
+	InTree bool
+	Passed bool
+	Reason string
+}
+
+// ForwardExplanation describes why this node did or did not relay the
+// message of Origin at Revision during Round.
+type ForwardExplanation struct {
+	Origin    string
+	Revision  int
+	Round     int
+	Forwarded bool
+	Paths     []PathDecision
+}
+
+func explainKey(origin string, revision int) string {
+	return origin + "_" + strconv.Itoa(revision)
+}
+
+// recordExplanation stores exp and forgets decisions older than ExplainRounds.
+func (a *Agent) recordExplanation(exp ForwardExplanation) {
+	a.explains[explainKey(exp.Origin, exp.Revision)] = exp
+	for k, e := range a.explains {
+		if a.Round-e.Round > ExplainRounds {
+			delete(a.explains, k)
+		}
+	}
+}
+
+// ExplainForward returns the forwarding decision taken for the message of
+// origin at revision. The second result is false if this node never had to
+// decide on that message, or the decision is older than ExplainRounds.
+func (a *Agent) ExplainForward(origin string, revision int) (ForwardExplanation, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	exp, ok := a.explains[explainKey(origin, revision)]
+	return exp, ok
+}
@@ -0,0 +1,115 @@
+package gossip
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// PhiThreshold is the default suspicion level above which a neighbor is
+// considered down. 8 means roughly one false positive in 10^8 heartbeats
+// when inter-arrival times are normally distributed.
+var PhiThreshold = 8.0
+
+// phiMaxSamples bounds the inter-arrival history kept per neighbor.
+var phiMaxSamples = 100
+
+// PhiDetector is a phi-accrual failure detector. It learns the distribution
+// of heartbeat inter-arrival times of each neighbor on the local clock and
+// reports how suspicious the current silence is, so jittery links get more
+// slack than stable ones.
+type PhiDetector struct {
+	mu sync.Mutex
+	// Threshold is the phi value above which a node is reported unavailable.
+	Threshold float64
+	// expected seeds the history of a newly seen node, and a quarter of it
+	// is the smallest standard deviation used.
+	expected time.Duration
+	windows  map[string]*arrivalWindow
+}
+
+type arrivalWindow struct {
+	last      time.Time
+	intervals []float64 // milliseconds
+}
+
+// NewPhiDetector creates a detector for heartbeats expected every interval.
+func NewPhiDetector(threshold float64, interval time.Duration) *PhiDetector {
+	return &PhiDetector{
+		Threshold: threshold,
+		expected:  interval,
+		windows:   make(map[string]*arrivalWindow),
+	}
+}
+
+// Heartbeat records that node was heard from at now.
+func (d *PhiDetector) Heartbeat(node string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, exist := d.windows[node]
+	if !exist {
+		// bootstrap with the expected interval and some spread around it
+		est := float64(d.expected / time.Millisecond)
+		d.windows[node] = &arrivalWindow{
+			last:      now,
+			intervals: []float64{est - est/4, est + est/4},
+		}
+		return
+	}
+	interval := float64(now.Sub(w.last) / time.Millisecond)
+	w.last = now
+	w.intervals = append(w.intervals, interval)
+	if len(w.intervals) > phiMaxSamples {
+		w.intervals = w.intervals[len(w.intervals)-phiMaxSamples:]
+	}
+}
+
+// Phi returns the suspicion level of node at now. Unknown nodes have phi 0.
+func (d *PhiDetector) Phi(node string, now time.Time) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, exist := d.windows[node]
+	if !exist {
+		return 0
+	}
+	mean, stdDev := meanStdDev(w.intervals)
+	stdDev = math.Max(stdDev, float64(d.expected/time.Millisecond)/4)
+	elapsed := float64(now.Sub(w.last) / time.Millisecond)
+	return phi(elapsed, mean, stdDev)
+}
+
+// Available reports whether node's phi at now is below the threshold.
+func (d *PhiDetector) Available(node string, now time.Time) bool {
+	return d.Phi(node, now) < d.Threshold
+}
+
+// Remove forgets the history of node.
+func (d *PhiDetector) Remove(node string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.windows, node)
+}
+
+// phi uses the logistic approximation of the normal CDF from Akka's
+// PhiAccrualFailureDetector.
+func phi(elapsed, mean, stdDev float64) float64 {
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1.0 + e))
+	}
+	return -math.Log10(1.0 - 1.0/(1.0+e))
+}
+
+func meanStdDev(xs []float64) (float64, float64) {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	var variance float64
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(xs)))
+}
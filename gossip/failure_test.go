@@ -0,0 +1,103 @@
+package gossip
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPhi(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed float64
+		want    float64
+	}{
+		// -log10 of the normal tail probability, the approximation is
+		// within a few percent
+		{"at the mean", 100, 0.301},
+		{"one deviation early", 90, 0.075},
+		{"one deviation late", 110, 0.800},
+		{"three deviations late", 130, 2.870},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := phi(tt.elapsed, 100, 10)
+			if math.Abs(got-tt.want) > 0.05*tt.want {
+				t.Errorf("phi = %.3f, want %.3f", got, tt.want)
+			}
+		})
+	}
+	// further out the approximation falls faster than the normal tail
+	if p := phi(200, 100, 10); p < PhiThreshold {
+		t.Errorf("phi ten deviations late = %.3f, below the threshold", p)
+	}
+	for e := 0.0; e < 300; e += 5 {
+		if phi(e, 100, 10) > phi(e+5, 100, 10) {
+			t.Fatalf("phi decreases after %v ms", e)
+		}
+	}
+}
+
+func TestPhiDetector(t *testing.T) {
+	d := NewPhiDetector(PhiThreshold, 100*time.Millisecond)
+	start := time.Now()
+	now := start
+	for i := 0; i < 20; i++ {
+		d.Heartbeat("stable", now)
+		// the jittery node alternates between 50ms and 150ms
+		d.Heartbeat("jittery", now.Add(time.Duration(i%2)*50*time.Millisecond))
+		now = now.Add(100 * time.Millisecond)
+	}
+	last := now.Add(-100 * time.Millisecond)
+
+	tests := []struct {
+		name      string
+		node      string
+		silence   time.Duration
+		available bool
+	}{
+		{"unknown", "other", time.Hour, true},
+		{"on time", "stable", 100 * time.Millisecond, true},
+		{"a little late", "stable", 150 * time.Millisecond, true},
+		{"long silence", "stable", time.Second, false},
+		{"jitter late", "jittery", 200 * time.Millisecond, true},
+		{"jitter long silence", "jittery", 2 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.Available(tt.node, last.Add(tt.silence)); got != tt.available {
+				t.Errorf("available after %v = %v, phi %.2f", tt.silence, got, d.Phi(tt.node, last.Add(tt.silence)))
+			}
+		})
+	}
+
+	// jitter buys slack
+	at := last.Add(250 * time.Millisecond)
+	if d.Phi("jittery", at) >= d.Phi("stable", at) {
+		t.Errorf("jittery phi %.2f not below stable phi %.2f", d.Phi("jittery", at), d.Phi("stable", at))
+	}
+
+	d.Remove("stable")
+	if p := d.Phi("stable", last.Add(time.Hour)); p != 0 {
+		t.Errorf("removed node has phi %.2f", p)
+	}
+}
+
+func TestPhiDetectorWindow(t *testing.T) {
+	defer func(n int) { phiMaxSamples = n }(phiMaxSamples)
+	phiMaxSamples = 5
+
+	d := NewPhiDetector(PhiThreshold, 100*time.Millisecond)
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		d.Heartbeat("A", now)
+		now = now.Add(time.Second)
+	}
+	if n := len(d.windows["A"].intervals); n != 5 {
+		t.Fatalf("kept %d intervals, want 5", n)
+	}
+	// the bootstrap samples are gone, one second is the norm now
+	if !d.Available("A", now) {
+		t.Errorf("A unavailable after its usual interval, phi %.2f", d.Phi("A", now))
+	}
+}
@@ -0,0 +1,68 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"time"
+)
+
+// LeaveRepeats is how often the leave notice is broadcast, UDP may drop some.
+var LeaveRepeats = 3
+
+// Leave announces that this node is shutting down. The signed notice is
+// relayed along the dissemination tree like any other message. Receivers
+// mark the node left at once instead of waiting for the failure detector,
+// and remove its edges after their next round's forwarding decisions, since
+// the notice itself is relayed along a tree that still contains the node.
+// Without a Key the notice is not authenticated and anyone can forge one.
+func (a *Agent) Leave() {
+	a.mu.Lock()
+	notice := common.NodeMessage{
+		NodeID:      a.NodeId,
+		Incarnation: a.BootID,
+		Revision:    a.Revision + 1,
+		Leave:       true,
+	}
+	notice.Signature = common.SignMessage(a.Key, notice)
+	msg := common.GossipMessage{
+		Self: notice,
+		Members: []common.MemberUpdate{{
+			Node:        a.NodeId,
+			State:       string(StateLeft),
+			Incarnation: a.incarnation,
+		}},
+	}
+	a.mu.Unlock()
+
+	fmt.Println(a.NodeId, " leaving the cluster")
+	for i := 0; i < LeaveRepeats; i++ {
+		a.DoBroadCast(msg)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// handleLeave processes the leave notice of msg.NodeID received along path.
+// The first valid notice marks the node left and is queued for relaying.
+func (a *Agent) handleLeave(msg common.NodeMessage, path Path) {
+	if !common.VerifyMessage(a.Key, msg) {
+		fmt.Println(a.NodeId, " reject leave notice with bad signature from ", msg.NodeID)
+		return
+	}
+	if a.markLeft(msg.NodeID) {
+		a.UpdateMsgs(msg, path, nil)
+	}
+}
+
+// markLeft records that node left and reports whether that is news.
+func (a *Agent) markLeft(node string) bool {
+	inc := 0
+	if m, exist := a.members[node]; exist {
+		if m.State == StateLeft {
+			return false
+		}
+		inc = m.Incarnation
+	}
+	fmt.Println(a.NodeId, " node ", node, " left the cluster")
+	a.setMember(node, StateLeft, inc)
+	return true
+}
@@ -0,0 +1,50 @@
+package gossip
+
+import (
+	"encoding/json"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLeaveAfterStop(t *testing.T) {
+	defer func(d time.Duration) { RoundInterval = d }(RoundInterval)
+	RoundInterval = 10 * time.Millisecond
+
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	a := newTestAgent(t, "A")
+	a.ListenAddr = "127.0.0.1:0"
+	a.BroadcastAddr = peer.LocalAddr().String()
+	stop := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		a.Start(stop, 1<<30)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent did not stop")
+	}
+	buf := make([]byte, 65535)
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := peer.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("no leave notice: %v", err)
+		}
+		var msg common.GossipMessage
+		if json.Unmarshal(buf[:n], &msg) == nil && msg.Self.Leave {
+			return
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"math"
+	"sort"
+	"time"
+)
+
+type MemberState string
+
+const (
+	StateAlive   MemberState = "alive"
+	StateSuspect MemberState = "suspect"
+	StateDead    MemberState = "dead"
+	StateLeft    MemberState = "left"
+)
+
+// SuspectRounds is how many rounds a suspicion may stay unrefuted before the
+// member is declared dead.
+var SuspectRounds = 3
+
+// DeadMemberRounds is how many rounds a dead or departed member is
+// remembered, so stale updates about it are still recognized, before it is
+// dropped from the membership list.
+var DeadMemberRounds = 30
+
+// Member is the local view of one node's membership.
+type Member struct {
+	Node        string
+	State       MemberState
+	Incarnation int
+	// Since is when the member entered its current state.
+	Since time.Time
+	// Round is the local round in which the member entered its current state.
+	Round int
+}
+
+type queuedUpdate struct {
+	update    common.MemberUpdate
+	remaining int
+}
+
+// Members returns the membership list, this node included, sorted by node.
+func (a *Agent) Members() []Member {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ms := []Member{{
+		Node:        a.NodeId,
+		State:       StateAlive,
+		Incarnation: a.incarnation,
+	}}
+	for _, m := range a.members {
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Node < ms[j].Node
+	})
+	return ms
+}
+
+// retransmits is how many rounds a membership change is piggybacked, it
+// grows logarithmically with the cluster size like in SWIM.
+func (a *Agent) retransmits() int {
+	return 2 * int(math.Ceil(math.Log2(float64(len(a.members)+2))))
+}
+
+func (a *Agent) queueMemberUpdate(u common.MemberUpdate) {
+	a.memberQueue[u.Node] = &queuedUpdate{update: u, remaining: a.retransmits()}
+}
+
+// setMember moves node into state at incarnation and disseminates the change.
+func (a *Agent) setMember(node string, state MemberState, inc int) {
+	m, exist := a.members[node]
+	if !exist {
+		m = &Member{Node: node}
+		a.members[node] = m
+	}
+	if exist && m.State == state && m.Incarnation == inc {
+		return
+	}
+	if !exist || m.State != state {
+		fmt.Println(a.NodeId, " member ", node, " -> ", state, " incarnation ", inc)
+		m.Since = time.Now()
+		m.Round = a.Round
+	}
+	m.State = state
+	m.Incarnation = inc
+	a.queueMemberUpdate(common.MemberUpdate{Node: node, State: string(state), Incarnation: inc})
+
+	if state == StateDead || state == StateLeft {
+		// the graph keeps the node until this round's forwarding decisions
+		// are made, a leave notice still has to be relayed along its tree
+		a.evictions = append(a.evictions, node)
+		delete(a.NodeBuf, node)
+		a.FD.Remove(node)
+	}
+}
+
+// isLive reports whether node may be part of the topology.
+func (a *Agent) isLive(node string) bool {
+	m, exist := a.members[node]
+	return !exist || (m.State != StateDead && m.State != StateLeft)
+}
+
+// evictMembers removes dead and departed members from the graph.
+func (a *Agent) evictMembers() {
+	for _, n := range a.evictions {
+		if !a.isLive(n) {
+			a.Graph.RemoveVertex(n)
+		}
+	}
+	a.evictions = nil
+}
+
+// applyMemberUpdate merges a disseminated update using the SWIM precedence
+// rules: a higher incarnation always wins, at the same incarnation suspect
+// overrides alive and dead or left override both.
+func (a *Agent) applyMemberUpdate(u common.MemberUpdate) {
+	state := MemberState(u.State)
+	if u.Node == a.NodeId {
+		if state == StateSuspect || state == StateDead {
+			// refute by outliving the suspicion with a higher incarnation
+			if u.Incarnation >= a.incarnation {
+				a.incarnation = u.Incarnation + 1
+				fmt.Println(a.NodeId, " refutes ", state, " with incarnation ", a.incarnation)
+				a.queueMemberUpdate(a.selfUpdate())
+			}
+		}
+		return
+	}
+
+	m, exist := a.members[u.Node]
+	if !exist {
+		a.setMember(u.Node, state, u.Incarnation)
+		return
+	}
+	switch state {
+	case StateAlive:
+		if u.Incarnation > m.Incarnation {
+			a.setMember(u.Node, state, u.Incarnation)
+		}
+	case StateSuspect:
+		if (m.State == StateAlive && u.Incarnation >= m.Incarnation) ||
+			(m.State == StateSuspect && u.Incarnation > m.Incarnation) {
+			a.setMember(u.Node, state, u.Incarnation)
+		}
+	case StateDead:
+		if (m.State == StateAlive || m.State == StateSuspect) && u.Incarnation >= m.Incarnation {
+			a.setMember(u.Node, state, u.Incarnation)
+		}
+	case StateLeft:
+		if m.State != StateLeft && u.Incarnation >= m.Incarnation {
+			a.setMember(u.Node, state, u.Incarnation)
+		}
+	}
+}
+
+func (a *Agent) selfUpdate() common.MemberUpdate {
+	return common.MemberUpdate{Node: a.NodeId, State: string(StateAlive), Incarnation: a.incarnation}
+}
+
+// updateMembers suspects neighbors the failure detector gave up on,
+// declares suspects dead once their suspicion timed out and forgets members
+// dead or gone for DeadMemberRounds rounds.
+func (a *Agent) updateMembers() {
+	now := time.Now()
+	for n := range a.NodeBuf {
+		if m, exist := a.members[n]; exist && m.State == StateAlive && !a.FD.Available(n, now) {
+			a.setMember(n, StateSuspect, m.Incarnation)
+		}
+	}
+	for n, m := range a.members {
+		if m.State == StateSuspect && a.Round-m.Round >= SuspectRounds {
+			a.setMember(n, StateDead, m.Incarnation)
+		}
+		if _, queued := a.memberQueue[n]; !a.isLive(n) && !queued && a.Round-m.Round >= DeadMemberRounds {
+			delete(a.members, n)
+			// nor count it as an origin gone silent
+			delete(a.heard, n)
+			delete(a.silent, n)
+		}
+	}
+}
+
+// memberUpdates returns the updates to piggyback on this round's gossip.
+func (a *Agent) memberUpdates() []common.MemberUpdate {
+	updates := []common.MemberUpdate{a.selfUpdate()}
+	for n, q := range a.memberQueue {
+		if n != a.NodeId {
+			updates = append(updates, q.update)
+		}
+		q.remaining--
+		if q.remaining <= 0 {
+			delete(a.memberQueue, n)
+		}
+	}
+	return updates
+}
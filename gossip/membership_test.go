@@ -0,0 +1,68 @@
+package gossip
+
+import (
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestAgent returns an agent whose database lives in a temporary
+// directory.
+func newTestAgent(t *testing.T, id string) *Agent {
+	t.Helper()
+	a := InitAgent(id, 0, t.TempDir())
+	a.Round = 1
+	return a
+}
+
+func TestDeadMemberRefutesWhenHeardDirectly(t *testing.T) {
+	a := newTestAgent(t, "A")
+	b := newTestAgent(t, "B")
+
+	a.HandleMsg(b.generateGossipMessage())
+	a.setMember("B", StateDead, 0)
+	// let the dead update run out of retransmits
+	for i := 0; i < 20; i++ {
+		a.memberUpdates()
+	}
+
+	for i := 0; i < 5; i++ {
+		a.HandleMsg(b.generateGossipMessage())
+		b.HandleMsg(a.generateGossipMessage())
+	}
+
+	if b.incarnation == 0 {
+		t.Fatalf("B never refuted its death")
+	}
+	m := a.members["B"]
+	if m.State != StateAlive || m.Incarnation != b.incarnation {
+		t.Fatalf("A sees B as %s at incarnation %d, want alive at %d", m.State, m.Incarnation, b.incarnation)
+	}
+}
+
+func TestDeadMembersForgotten(t *testing.T) {
+	a := newTestAgent(t, "A")
+	a.setMember("B", StateDead, 0)
+	a.setMember("C", StateLeft, 0)
+	a.setMember("D", StateSuspect, 0)
+	a.setMember("E", StateAlive, 0)
+	a.hear("B")
+
+	a.Round += DeadMemberRounds
+	a.updateMembers()
+	if _, exist := a.members["B"]; !exist {
+		t.Fatal("dead member forgotten while its update is still gossiped")
+	}
+	for len(a.memberQueue) > 0 {
+		a.memberUpdates()
+	}
+	a.updateMembers()
+	for n, want := range map[string]bool{"B": false, "C": false, "D": true, "E": true} {
+		if _, exist := a.members[n]; exist != want {
+			t.Errorf("member %s kept %v, want %v", n, exist, want)
+		}
+	}
+	if _, exist := a.heard["B"]; exist {
+		t.Error("forgotten member still counted as an origin")
+	}
+}
@@ -0,0 +1,57 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+)
+
+// Multicast restricts the dissemination of this node's messages to the given
+// target nodes. Calling it with no targets goes back to broadcasting.
+func (a *Agent) Multicast(targets []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Targets = append([]string(nil), targets...)
+	sort.Strings(a.Targets)
+}
+
+// checkSteinerPath is the multicast counterpart of checkTreePath. The
+// message only travels along the Steiner tree that connects the path root to
+// the targets, and self relays only if the tree continues below it.
+// When some targets lie beyond the local 2-hop view there is no way to tell
+// which branch leads to them, so the decision falls back to the regular tree.
+func checkSteinerPath(self string, view *common.Graph, p Path, msg common.NodeMessage) PathDecision {
+	targets := msg.Targets
+	var known []string
+	for _, t := range targets {
+		if view.HasVertex(t) {
+			known = append(known, t)
+		}
+	}
+	if len(known) < len(targets) {
+		d := checkTreePath(self, view, p, msg.TreeMode, msg.TreeDepth)
+		d.Reason = "targets outside local view, " + d.Reason
+		return d
+	}
+
+	st := view.SteinerTree(p[0], known)
+	d := PathDecision{
+		Path: p,
+		Root: p[0],
+		Mode: "steiner",
+		Tree: st.Adjacency(),
+	}
+	if !st.PathExists(p) {
+		d.Reason = "path does not exist in steiner tree"
+		return d
+	}
+	d.InTree = true
+	// no target below this node, prune the branch
+	if st.IsLeaf(self) {
+		d.Leaf = true
+		d.Reason = "no target below this node"
+		return d
+	}
+	d.Passed = true
+	d.Reason = "path exists in steiner tree"
+	return d
+}
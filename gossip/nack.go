@@ -0,0 +1,163 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"strconv"
+)
+
+// NACK repair limits. A gap is NACKed at most NackAttempts times, every
+// NackInterval rounds. A node repairs the same revision at most once per
+// RepairInterval rounds and sends at most MaxRepairsPerRound repairs per
+// round, so a popular NACK does not cause an implosion of answers.
+var (
+	NackInterval       = 2
+	NackAttempts       = 3
+	MaxNacksPerRound   = 16
+	RepairInterval     = 3
+	MaxRepairsPerRound = 8
+)
+
+// missingRevs are the revisions of one origin's current incarnation that
+// are ahead of the stored one but could not be taken.
+type missingRevs struct {
+	incarnation int64
+	revs        map[int]bool
+	askedRound  int
+	attempts    int
+}
+
+func repairKey(msg common.NodeMessage) string {
+	return msg.NodeID + "_" + strconv.FormatInt(msg.Incarnation, 10) + "_" + strconv.Itoa(msg.Revision)
+}
+
+// nackRevision asks for revision rev of origin, a delta whose base is not
+// held here. Revisions skipped between two stored ones are no gaps: relays
+// only pass on the newest revision of an origin, and an older one would
+// not be stored anyway.
+func (a *Agent) nackRevision(origin string, inc int64, rev int) {
+	m, exist := a.missing[origin]
+	if !exist || m.incarnation != inc {
+		m = &missingRevs{incarnation: inc, revs: make(map[int]bool), askedRound: -NackInterval}
+		a.missing[origin] = m
+	}
+	m.revs[rev] = true
+	m.attempts = 0
+	fmt.Println(a.NodeId, " missed revision ", rev, " of ", origin)
+}
+
+// resolveNacks forgets the requested revisions of msg's origin that msg
+// makes obsolete.
+func (a *Agent) resolveNacks(msg common.NodeMessage) {
+	m, exist := a.missing[msg.NodeID]
+	if !exist {
+		return
+	}
+	if m.incarnation < msg.Incarnation {
+		delete(a.missing, msg.NodeID)
+		return
+	}
+	if m.incarnation != msg.Incarnation {
+		return
+	}
+	for r := range m.revs {
+		if r <= msg.Revision {
+			delete(m.revs, r)
+		}
+	}
+}
+
+// nacksToSend compacts the requested revisions into NACK ranges.
+func (a *Agent) nacksToSend() []common.Nack {
+	var nacks []common.Nack
+	for origin, m := range a.missing {
+		if len(m.revs) == 0 || m.attempts >= NackAttempts {
+			delete(a.missing, origin)
+			continue
+		}
+		if a.Round-m.askedRound < NackInterval || len(nacks) >= MaxNacksPerRound {
+			continue
+		}
+		m.askedRound = a.Round
+		m.attempts++
+		revs := make([]int, 0, len(m.revs))
+		for r := range m.revs {
+			revs = append(revs, r)
+		}
+		sort.Ints(revs)
+		for i := 0; i < len(revs); {
+			j := i
+			for j+1 < len(revs) && revs[j+1] == revs[j]+1 {
+				j++
+			}
+			nacks = append(nacks, common.Nack{
+				Origin:      origin,
+				Incarnation: m.incarnation,
+				From:        revs[i],
+				To:          revs[j],
+			})
+			i = j + 1
+		}
+	}
+	return nacks
+}
+
+// handleNacks answers every NACK with the newest full message held of its
+// origin, if that is at least the first requested revision. A newer
+// revision serves as well, it replaces the requested ones.
+func (a *Agent) handleNacks(nacks []common.Nack) {
+	for _, n := range nacks {
+		h := a.history[n.Origin]
+		for i := len(h) - 1; i >= 0; i-- {
+			msg := h[i]
+			if msg.Incarnation != n.Incarnation || msg.Revision < n.From {
+				continue
+			}
+			key := repairKey(msg)
+			if last, done := a.repaired[key]; !done || a.Round-last >= RepairInterval {
+				a.repairs[key] = msg
+			}
+			break
+		}
+	}
+}
+
+// repairsToSend returns the queued repairs, at most MaxRepairsPerRound.
+func (a *Agent) repairsToSend() []common.NodeMessage {
+	keys := make([]string, 0, len(a.repairs))
+	for k := range a.repairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var msgs []common.NodeMessage
+	for _, k := range keys {
+		if len(msgs) >= MaxRepairsPerRound {
+			break
+		}
+		msgs = append(msgs, a.repairs[k])
+		a.repaired[k] = a.Round
+		delete(a.repairs, k)
+	}
+	for k, r := range a.repaired {
+		if a.Round-r >= RepairInterval {
+			delete(a.repaired, k)
+		}
+	}
+	return msgs
+}
+
+// handleRepairs fills gaps with retransmitted messages. Overhearing a repair
+// also cancels the same repair queued here.
+func (a *Agent) handleRepairs(msgs []common.NodeMessage) {
+	for _, msg := range msgs {
+		if msg.NodeID == a.NodeId {
+			continue
+		}
+		key := repairKey(msg)
+		delete(a.repairs, key)
+		a.repaired[key] = a.Round
+		a.remember(msg)
+		a.storeMsg(msg)
+	}
+}
@@ -0,0 +1,137 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func fullMsg(origin string, rev int, value string) common.NodeMessage {
+	return common.NodeMessage{NodeID: origin, Incarnation: 1, Revision: rev,
+		Data: map[string]common.Value{"v": common.StringValue(value)}}
+}
+
+func TestCollapsedRevisionsAreNoGap(t *testing.T) {
+	a := newTestAgent(t, "X")
+	a.storeMsg(fullMsg("A", 1, "1"))
+	a.storeMsg(fullMsg("A", 5, "5"))
+	if len(a.missing) != 0 {
+		t.Errorf("skipped revisions count as missing: %+v", a.missing["A"])
+	}
+	if nacks := a.nacksToSend(); len(nacks) != 0 {
+		t.Errorf("NACKs %v", nacks)
+	}
+}
+
+func TestNackUnmergeableDelta(t *testing.T) {
+	a := newTestAgent(t, "X")
+	a.storeMsg(fullMsg("A", 1, "1"))
+	delta := fullMsg("A", 5, "5")
+	delta.Delta, delta.Base = true, 3
+	if a.storeMsg(delta) {
+		t.Fatalf("stored a delta on a base not held")
+	}
+
+	want := []common.Nack{{Origin: "A", Incarnation: 1, From: 5, To: 5}}
+	for attempt := 0; attempt < NackAttempts; attempt++ {
+		if nacks := a.nacksToSend(); !reflect.DeepEqual(nacks, want) {
+			t.Fatalf("attempt %d: NACKs %v, want %v", attempt, nacks, want)
+		}
+		if nacks := a.nacksToSend(); len(nacks) != 0 {
+			t.Fatalf("NACKed again within the interval: %v", nacks)
+		}
+		a.Round += NackInterval
+	}
+	if nacks := a.nacksToSend(); len(nacks) != 0 || len(a.missing) != 0 {
+		t.Errorf("NACKed after %d attempts: %v", NackAttempts, nacks)
+	}
+
+	// a newer full message settles the request
+	a.storeMsg(delta)
+	a.storeMsg(fullMsg("A", 6, "6"))
+	if len(a.missing["A"].revs) != 0 {
+		t.Errorf("still missing %v after revision 6", a.missing["A"].revs)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	holder := newTestAgent(t, "B")
+	for rev := 1; rev <= 5; rev++ {
+		holder.storeMsg(fullMsg("A", rev, strconv.Itoa(rev)))
+	}
+	holder.storeMsg(common.NodeMessage{NodeID: "C", Incarnation: 1, Revision: 2})
+
+	tests := []struct {
+		name string
+		nack common.Nack
+		want []int
+	}{
+		{"newest answers older", common.Nack{Origin: "A", Incarnation: 1, From: 3, To: 3}, []int{5}},
+		{"exact", common.Nack{Origin: "A", Incarnation: 1, From: 5, To: 5}, []int{5}},
+		{"ahead of what is held", common.Nack{Origin: "A", Incarnation: 1, From: 6, To: 7}, nil},
+		{"other boot", common.Nack{Origin: "A", Incarnation: 2, From: 1, To: 1}, nil},
+		{"unknown origin", common.Nack{Origin: "Z", Incarnation: 1, From: 1, To: 1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holder.repaired = make(map[string]int)
+			holder.handleNacks([]common.Nack{tt.nack})
+			var got []int
+			for _, m := range holder.repairsToSend() {
+				got = append(got, m.Revision)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repairs %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the same repair is not sent again within RepairInterval
+	holder.handleNacks([]common.Nack{{Origin: "A", Incarnation: 1, From: 5, To: 5}})
+	holder.repairsToSend()
+	holder.handleNacks([]common.Nack{{Origin: "A", Incarnation: 1, From: 5, To: 5}})
+	if rs := holder.repairsToSend(); len(rs) != 0 {
+		t.Errorf("repeated repair %v", rs)
+	}
+	holder.Round += RepairInterval
+	holder.repairsToSend()
+	holder.handleNacks([]common.Nack{{Origin: "A", Incarnation: 1, From: 5, To: 5}})
+	if rs := holder.repairsToSend(); len(rs) != 1 {
+		t.Errorf("%d repairs after RepairInterval, want 1", len(rs))
+	}
+
+	// the requester takes the repair, a node that overhears it drops its own
+	requester := newTestAgent(t, "X")
+	requester.storeMsg(fullMsg("A", 1, "1"))
+	requester.nackRevision("A", 1, 4)
+	other := newTestAgent(t, "Y")
+	other.storeMsg(fullMsg("A", 5, "5"))
+	other.handleNacks([]common.Nack{{Origin: "A", Incarnation: 1, From: 4, To: 4}})
+	repair := []common.NodeMessage{fullMsg("A", 5, "5")}
+	requester.handleRepairs(repair)
+	other.handleRepairs(repair)
+	if v, _ := requester.GetState("A", "v"); !v.Equal(common.StringValue("5")) || len(requester.missing["A"].revs) != 0 {
+		t.Errorf("requester holds %v, missing %v", v, requester.missing["A"].revs)
+	}
+	if rs := other.repairsToSend(); len(rs) != 0 {
+		t.Errorf("overheard repair sent again: %v", rs)
+	}
+}
+
+func TestRepairLimit(t *testing.T) {
+	holder := newTestAgent(t, "B")
+	var nacks []common.Nack
+	for i := 0; i < MaxRepairsPerRound+3; i++ {
+		origin := "N" + strconv.Itoa(i)
+		holder.storeMsg(fullMsg(origin, 1, "1"))
+		nacks = append(nacks, common.Nack{Origin: origin, Incarnation: 1, From: 1, To: 1})
+	}
+	holder.handleNacks(nacks)
+	if n := len(holder.repairsToSend()); n != MaxRepairsPerRound {
+		t.Errorf("%d repairs in one round, want %d", n, MaxRepairsPerRound)
+	}
+	if n := len(holder.repairsToSend()); n != 3 {
+		t.Errorf("%d repairs in the next round, want 3", n)
+	}
+}
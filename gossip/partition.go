@@ -0,0 +1,177 @@
+package gossip
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// Partition detection heuristics. An origin that was heard regularly but not
+// within the last PartitionStaleRounds rounds counts as silent. When, within
+// PartitionWindowRounds rounds, at least PartitionMinNodes nodes and
+// PartitionFraction of all known origins go silent, get suspected or drop
+// out of the local component, and at least one of those signs was seen
+// locally, the network is considered split. A partition heals once half of
+// its nodes are heard from again.
+var (
+	PartitionStaleRounds  = 6
+	PartitionWindowRounds = 3
+	PartitionMinNodes     = 2
+	PartitionFraction     = 0.3
+)
+
+// PartitionHistory bounds the number of partitions kept for reporting.
+var PartitionHistory = 16
+
+// Partition is a suspected split of the network. Nodes are on the far side.
+type Partition struct {
+	Nodes       []string
+	Round       int
+	Detected    time.Time
+	Healed      bool
+	HealedRound int
+	HealedAt    time.Time
+
+	// nodes still in the local component when the partition was detected,
+	// they only count as back once heard from again
+	reachable map[string]bool
+}
+
+// Partitions returns the partitions detected so far, most recent last.
+func (a *Agent) Partitions() []Partition {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ps := make([]Partition, 0, len(a.partitions))
+	for _, p := range a.partitions {
+		ps = append(ps, *p)
+	}
+	return ps
+}
+
+// checkPartition collects this round's signs of a split and reports
+// partitions and heals.
+func (a *Agent) checkPartition() {
+	now := time.Now()
+
+	known := 0
+	for n, h := range a.heard {
+		if m, member := a.members[n]; n == a.NodeId || (member && m.State == StateLeft) {
+			continue
+		}
+		known++
+		silent := h.regular() && a.Round-h.last > PartitionStaleRounds
+		if silent && !a.silent[n] {
+			a.lostSince(n)
+		}
+		a.silent[n] = silent
+	}
+
+	for n, m := range a.members {
+		if (m.State == StateSuspect || m.State == StateDead) && m.Round == a.Round {
+			a.lostSince(n)
+			a.localSign = PartitionWindowRounds
+		}
+	}
+
+	component := make(map[string]bool)
+	for _, v := range a.Graph.Reachable(a.NodeId) {
+		component[v] = true
+	}
+	for v := range a.component {
+		if v != a.NodeId && !component[v] && a.isLive(v) {
+			a.lostSince(v)
+			a.localSign = PartitionWindowRounds
+		}
+	}
+	a.component = component
+
+	for n, r := range a.lost {
+		if a.Round-r >= PartitionWindowRounds {
+			delete(a.lost, n)
+		}
+	}
+	if len(a.lost) >= PartitionMinNodes &&
+		float64(len(a.lost)) >= PartitionFraction*float64(known) &&
+		a.localSign > 0 {
+		a.openPartition(now)
+	}
+	if a.localSign > 0 {
+		a.localSign--
+	}
+	a.checkHeal(now)
+}
+
+// heard records in which rounds messages of an origin arrived. An origin
+// whose payload never changes is only heard from by its neighbors, so only
+// origins heard regularly can be told to have gone silent.
+type heard struct {
+	last, prev int
+	rounds     int
+}
+
+// regular reports whether the last two receipts were at most
+// PartitionStaleRounds rounds apart.
+func (h heard) regular() bool {
+	return h.rounds >= 2 && h.last-h.prev <= PartitionStaleRounds
+}
+
+// hear records a message of origin, whatever its revision. Copies arriving
+// within the same round count once.
+func (a *Agent) hear(origin string) {
+	h := a.heard[origin]
+	if h.rounds == 0 || h.last != a.Round {
+		h.prev = h.last
+		h.rounds++
+	}
+	h.last = a.Round
+	a.heard[origin] = h
+}
+
+func (a *Agent) lostSince(node string) {
+	if _, exist := a.lost[node]; !exist {
+		a.lost[node] = a.Round
+	}
+}
+
+func (a *Agent) openPartition(now time.Time) {
+	p := &Partition{Round: a.Round, Detected: now, reachable: make(map[string]bool)}
+	for n := range a.lost {
+		p.Nodes = append(p.Nodes, n)
+		if a.component[n] {
+			p.reachable[n] = true
+		}
+	}
+	sort.Strings(p.Nodes)
+	a.lost = make(map[string]int)
+	a.partitions = append(a.partitions, p)
+	if len(a.partitions) > PartitionHistory {
+		a.partitions = a.partitions[len(a.partitions)-PartitionHistory:]
+	}
+	log.Printf("%s partition detected in round %d, unreachable: %v", a.NodeId, a.Round, p.Nodes)
+	a.publishTopology(TopologyEvent{Type: EventPartitionSuspected, Round: a.Round, Nodes: p.Nodes})
+}
+
+// checkHeal closes the open partitions whose nodes are heard from again.
+func (a *Agent) checkHeal(now time.Time) {
+	for _, p := range a.partitions {
+		if p.Healed {
+			continue
+		}
+		var back []string
+		for _, n := range p.Nodes {
+			m, member := a.members[n]
+			if h := a.heard[n]; (a.component[n] && !p.reachable[n]) || (h.rounds > 0 && h.last > p.Round) ||
+				(member && m.State == StateAlive && m.Round > p.Round) {
+				back = append(back, n)
+			}
+		}
+		if 2*len(back) < len(p.Nodes) {
+			continue
+		}
+		p.Healed = true
+		p.HealedRound = a.Round
+		p.HealedAt = now
+		log.Printf("%s partition of round %d healed in round %d, reachable again: %v", a.NodeId, p.Round, a.Round, back)
+		a.publishTopology(TopologyEvent{Type: EventPartitionHealed, Round: a.Round, Nodes: back})
+	}
+}
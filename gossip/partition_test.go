@@ -0,0 +1,73 @@
+package gossip
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartitionDetection(t *testing.T) {
+	a := newTestAgent(t, "A")
+	events := a.SubscribeTopology()
+	neighbors := map[string]*Agent{}
+	for _, id := range []string{"B", "C", "D", "E"} {
+		neighbors[id] = newTestAgent(t, id)
+	}
+	var suspect string
+	round := func(hear ...string) {
+		a.Round++
+		if suspect != "" {
+			a.setMember(suspect, StateSuspect, 0)
+			suspect = ""
+		}
+		for _, id := range hear {
+			n := neighbors[id]
+			n.Round = a.Round
+			a.HandleMsg(n.generateGossipMessage())
+		}
+		a.checkPartition()
+	}
+	partitionEvents := func() []TopologyEvent {
+		var evs []TopologyEvent
+		for len(events) > 0 {
+			if ev := <-events; ev.Type == EventPartitionSuspected || ev.Type == EventPartitionHealed {
+				evs = append(evs, ev)
+			}
+		}
+		return evs
+	}
+
+	// static payloads heard every round are not silence
+	for i := 0; i < 2*PartitionStaleRounds; i++ {
+		round("B", "C", "D", "E")
+	}
+	suspect = "B"
+	round("B", "C", "D", "E")
+	if ps := a.Partitions(); len(ps) != 0 {
+		t.Fatalf("partition reported while every origin is heard: %v", ps[0].Nodes)
+	}
+	if evs := partitionEvents(); len(evs) != 0 {
+		t.Fatalf("partition events while every origin is heard: %+v", evs)
+	}
+
+	for i := 0; i < 3*PartitionStaleRounds && !a.silent["E"]; i++ {
+		round("B")
+	}
+	suspect = "C"
+	round("B")
+	ps := a.Partitions()
+	if len(ps) != 1 || !reflect.DeepEqual(ps[0].Nodes, []string{"C", "D", "E"}) {
+		t.Fatalf("got partitions %+v, want one of [C D E]", ps)
+	}
+	evs := partitionEvents()
+	if len(evs) != 1 || !reflect.DeepEqual(evs[0].Nodes, ps[0].Nodes) {
+		t.Fatalf("got events %+v, want one partition-suspected for %v", evs, ps[0].Nodes)
+	}
+
+	round("B", "C", "D")
+	if ps := a.Partitions(); !ps[0].Healed {
+		t.Fatalf("partition not healed after C and D were heard again")
+	}
+	if evs := partitionEvents(); len(evs) != 1 || evs[0].Type != EventPartitionHealed {
+		t.Fatalf("got events %+v, want one partition-healed", evs)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net"
 	"strconv"
+	"time"
 )
 
 func (a *Agent) ReceiveMsg(conn *net.UDPConn, stopCh <-chan bool) {
@@ -18,7 +19,7 @@ func (a *Agent) ReceiveMsg(conn *net.UDPConn, stopCh <-chan bool) {
 			fmt.Println(a.NodeId, "Received stop signal, stopping goroutine")
 			return
 		default:
-			n, _, err := conn.ReadFromUDP(buf)
+			n, addr, err := conn.ReadFromUDP(buf)
 			if err != nil {
 				//log.Printf("%s Failed to read UDP message: %v", a.NodeId, err)
 				continue
@@ -29,6 +30,7 @@ func (a *Agent) ReceiveMsg(conn *net.UDPConn, stopCh <-chan bool) {
 				log.Printf("Failed to unmarshal message: %v", err)
 				continue
 			}
+			a.recordAddr(msg.Self.NodeID, addr)
 			a.HandleMsg(msg)
 		}
 	}
@@ -36,35 +38,99 @@ func (a *Agent) ReceiveMsg(conn *net.UDPConn, stopCh <-chan bool) {
 
 func (a *Agent) HandleMsg(msg common.GossipMessage) {
 	fmt.Println(a.NodeId, "handle ", msg)
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	//1. first get network topo
 	// get direct node msg
 	dmsg := msg.Self
 	if dmsg.NodeID == a.NodeId {
 		return
 	}
+	if dmsg.Leave {
+		a.handleLeave(dmsg, Path{dmsg.NodeID})
+		return
+	}
 	// 加入一跳桶
-	rev, exist := a.NodeBuf[dmsg.NodeID]
+	ver, exist := a.NodeBuf[dmsg.NodeID]
+	a.FD.Heartbeat(dmsg.NodeID, time.Now())
 	a.Graph.AddEdge(a.NodeId, dmsg.NodeID)
-	if exist {
-		if rev < dmsg.Revision {
-			a.NodeBuf[dmsg.NodeID] = dmsg.Revision
+	if !exist || ver.Less(dmsg.Version()) {
+		a.NodeBuf[dmsg.NodeID] = dmsg.Version()
+	}
+
+	// merge membership, we heard the sender directly so it is at least known
+	if _, known := a.members[dmsg.NodeID]; !known {
+		a.setMember(dmsg.NodeID, StateAlive, 0)
+	}
+	for _, u := range msg.Members {
+		a.applyMemberUpdate(u)
+	}
+	// a suspect or dead member that still talks to us has not heard about
+	// it, tell it again so it can refute
+	if m := a.members[dmsg.NodeID]; m.State == StateSuspect || m.State == StateDead {
+		if _, queued := a.memberQueue[dmsg.NodeID]; !queued {
+			a.queueMemberUpdate(common.MemberUpdate{Node: m.Node, State: string(m.State), Incarnation: m.Incarnation})
+		}
+	}
+
+	if v, exist := msg.Acks[a.NodeId]; exist {
+		a.acked[dmsg.NodeID] = v
+	}
+
+	a.mergeCRDT(msg.CRDT, msg.CRDTDigest)
+	for _, se := range msg.Events {
+		if a.isLive(se.PrevNode) {
+			a.handleEvent(se, dmsg.NodeID)
+		}
+	}
+	for _, sq := range msg.Queries {
+		if a.isLive(sq.PrevNode) {
+			a.handleQuery(sq, dmsg.NodeID)
 		}
-	} else {
-		a.NodeBuf[dmsg.NodeID] = dmsg.Revision
 	}
+	for _, r := range msg.Responses {
+		a.handleResponse(r)
+	}
+
+	a.handleRepairs(msg.Repairs)
+	a.handleNacks(msg.Nacks)
 
 	// add msg
 	path := Path{dmsg.NodeID}
-	a.UpdateMsgs(dmsg, path)
+	a.UpdateMsgs(dmsg, path, []string{dmsg.NodeID})
+
+	// the sender lists every live neighbor as a PrevNode, see
+	// generateGossipMessage, so a 2-hop edge it no longer reports is gone.
+	// Without this 2-hop edges never leave the graph and no edge down event
+	// is published for them.
+	reported := make(map[string]bool)
+	for _, m := range msg.Msgs {
+		reported[m.PrevNode] = true
+	}
+	for _, n := range a.Graph.FindNeighbor(dmsg.NodeID) {
+		if n != a.NodeId && !reported[n] {
+			a.Graph.RemoveEdge(dmsg.NodeID, n)
+		}
+	}
+
+	// leave notices first, so their nodes are not added back below
+	for _, m := range msg.Msgs {
+		if m.NodeMsg.Leave && m.NodeMsg.NodeID != a.NodeId {
+			a.handleLeave(m.NodeMsg, Path{m.PrevNode, dmsg.NodeID})
+		}
+	}
 
 	// handle other msg
 	for _, m := range msg.Msgs {
+		if !a.isLive(m.PrevNode) {
+			continue
+		}
 		a.Graph.AddEdge(dmsg.NodeID, m.PrevNode)
 		// handle msg
-		if !common.IsStructEmpty(m.NodeMsg) {
+		if !common.IsStructEmpty(m.NodeMsg) && !m.NodeMsg.Leave {
 			path = Path{m.PrevNode, dmsg.NodeID}
 			if m.NodeMsg.NodeID != a.NodeId {
-				a.UpdateMsgs(m.NodeMsg, path)
+				a.UpdateMsgs(m.NodeMsg, path, m.Route)
 			}
 		}
 		// 如果不在一跳桶，那么将prevNode 加入二跳桶
@@ -76,20 +142,53 @@ func (a *Agent) HandleMsg(msg common.GossipMessage) {
 
 // 处理接收到的Gossip消息
 func (a *Agent) PathExistInMLST(p Path) bool {
+	d := checkTreePath(a.NodeId, a.Graph.Snapshot(), p, common.TreeMLST, 0)
+	a.logDecision(d)
+	return d.Passed
+}
+
+func (a *Agent) logDecision(d PathDecision) {
+	fmt.Println(a.NodeId, " root: ", d.Root, " path: ", d.Path, " mode: ", d.Mode, " tree: ", d.Tree, " ", d.Reason)
+}
+
+// checkPath decides whether msg, received along p, is relayed by node self
+// whose view of the topology is view.
+func checkPath(self string, view *common.Graph, p Path, msg common.NodeMessage) PathDecision {
+	if len(msg.Targets) > 0 {
+		return checkSteinerPath(self, view, p, msg)
+	}
+	return checkTreePath(self, view, p, msg.TreeMode, msg.TreeDepth)
+}
 
+// checkTreePath runs the PathExistInMLST check for node self against a
+// frozen graph view, building the tree with the given mode.
+func checkTreePath(self string, view *common.Graph, p Path, mode string, maxDepth int) PathDecision {
 	preNode := p[0]
-	mlst, _ := a.Graph.MLST10(preNode)
-	fmt.Println(a.NodeId, " root: ", preNode, " path: ", p, " mlst: ")
-	mlst.Display()
+	if mode == "" {
+		mode = common.TreeMLST
+	}
+	mlst := view.BuildTree(mode, preNode, maxDepth)
+	d := PathDecision{
+		Path: p,
+		Root: preNode,
+		Mode: mode,
+		Tree: mlst.Adjacency(),
+	}
 	// if node is leaf, return false
-	if mlst.IsLeaf(a.NodeId) {
-		return false
+	if mlst.IsLeaf(self) {
+		d.Leaf = true
+		d.Reason = "node is a leaf of the tree"
+		return d
 	}
 
 	if mlst.PathExists(p) {
-		return true
+		d.InTree = true
+		d.Passed = true
+		d.Reason = "path exists in tree"
+		return d
 	}
-	return false
+	d.Reason = "path does not exist in tree"
+	return d
 }
 
 func (a *Agent) Write2DB(msg common.NodeMessage) {
@@ -106,16 +205,61 @@ func (a *Agent) Write2DB(msg common.NodeMessage) {
 	}
 }
 
-func (a *Agent) UpdateMsgs(msg common.NodeMessage, path Path) {
-	_, exist := a.Msgs[msg.NodeID]
-	Hm := HostMsg{
-		Msg: msg,
+// recordAddr remembers where node's broadcasts come from, the address its
+// sync listener shares.
+func (a *Agent) recordAddr(node string, addr *net.UDPAddr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addrs[node] = &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+}
+
+// UpdateMsgs stores msg, received along path after travelling route, and
+// queues it for relaying. A delta is relayed as the full message merged
+// here, the base it was built on is only known to the origin's neighbors.
+func (a *Agent) UpdateMsgs(msg common.NodeMessage, path Path, route []string) {
+	a.hear(msg.NodeID)
+	if a.storeMsg(msg) && len(route) > 0 {
+		s := a.store[msg.NodeID]
+		s.Route = route
+		a.store[msg.NodeID] = s
 	}
-	if exist {
-		sendpath := append(a.Msgs[msg.NodeID].SendPaths, path)
-		Hm.SendPaths = sendpath
-	} else {
-		Hm.SendPaths = []Path{path}
+	if msg.Delta {
+		s, exist := a.store[msg.NodeID]
+		if !exist || s.Msg.Version() != msg.Version() {
+			// not merged here, nothing to vouch for
+			return
+		}
+		msg = s.Msg
+	}
+	old, exist := a.Msgs[msg.NodeID]
+	if !exist && a.Seen.Seen(msg.NodeID, msg.Version(), time.Now()) {
+		// this payload version was relayed or dropped in an earlier round
+		return
+	}
+	if exist && msg.Version().Less(old.Msg.Version()) {
+		// a newer version is already waiting to be relayed
+		return
+	}
+	if exist && old.Msg.Version() == msg.Version() {
+		old.SendPaths = append(old.SendPaths, path)
+		a.Msgs[msg.NodeID] = old
+		return
+	}
+	a.Msgs[msg.NodeID] = HostMsg{
+		Msg:       msg,
+		SendPaths: []Path{path},
+		Route:     route,
+		Round:     a.Round,
+	}
+}
+
+// nodeRestarted forgets what was learned about node's previous boot.
+func (a *Agent) nodeRestarted(node string) {
+	fmt.Println(a.NodeId, " node ", node, " restarted")
+	if m, exist := a.members[node]; exist && m.State != StateAlive {
+		// the new boot starts counting incarnations from scratch
+		delete(a.members, node)
+		a.setMember(node, StateAlive, 0)
 	}
-	a.Msgs[msg.NodeID] = Hm
+	a.publishTopology(TopologyEvent{Type: EventNodeRestarted, Round: a.Round, Node: node})
 }
@@ -0,0 +1,146 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultEventHopLimit is the hop limit of published events unless the
+// agent's EventHopLimit is set.
+var DefaultEventHopLimit = 16
+
+// hostEvent is a received event waiting for its relay decision, like
+// HostMsg for node messages.
+type hostEvent struct {
+	Event     common.Event
+	SendPaths []Path
+	Round     int
+	Forwarded bool
+}
+
+// Publish sends a one-shot event on topic to every node, local subscribers
+// included, and returns its ID.
+func (a *Agent) Publish(topic string, payload []byte) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.eventSeq++
+	limit := a.EventHopLimit
+	if limit == 0 {
+		limit = DefaultEventHopLimit
+	}
+	ev := common.Event{
+		ID:       a.NodeId + "/" + strconv.FormatInt(a.BootID, 10) + "/" + strconv.Itoa(a.eventSeq),
+		Origin:   a.NodeId,
+		Topic:    topic,
+		Payload:  payload,
+		HopLimit: limit,
+	}
+	a.eventSeen.Add(ev.ID, common.Version{}, time.Now())
+	a.deliverEvent(ev)
+	a.published = append(a.published, ev)
+	return ev.ID
+}
+
+// Subscribe returns a channel receiving the events published on topic.
+// Events are dropped for subscribers that fall behind.
+func (a *Agent) Subscribe(topic string) <-chan common.Event {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	ch := make(chan common.Event, topologyBufSize)
+	a.eventSubs[topic] = append(a.eventSubs[topic], ch)
+	return ch
+}
+
+// Unsubscribe stops delivering events of topic to ch and closes it.
+func (a *Agent) Unsubscribe(topic string, ch <-chan common.Event) {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	subs := a.eventSubs[topic]
+	for i, c := range subs {
+		if c == ch {
+			a.eventSubs[topic] = append(subs[:i], subs[i+1:]...)
+			close(c)
+			return
+		}
+	}
+}
+
+// relayPath returns the first of paths along which this node is a relay of
+// the MLST in view.
+func (a *Agent) relayPath(view *common.Graph, paths []Path) (Path, bool) {
+	for _, p := range paths {
+		allP := append(append(Path{}, p...), a.NodeId)
+		if checkTreePath(a.NodeId, view, allP, common.TreeMLST, 0).Passed {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (a *Agent) deliverEvent(ev common.Event) {
+	fmt.Println(a.NodeId, " event ", ev.ID, " topic: ", ev.Topic)
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	for _, c := range a.eventSubs[ev.Topic] {
+		select {
+		case c <- ev:
+		default:
+		}
+	}
+}
+
+// handleEvent takes an event relayed by sender. The first copy is delivered,
+// every copy adds a path to check against the tree.
+func (a *Agent) handleEvent(se common.SendEvent, sender string) {
+	ev := se.Event
+	path := Path{sender}
+	if se.PrevNode != sender {
+		path = Path{se.PrevNode, sender}
+	}
+	if he, exist := a.events[ev.ID]; exist {
+		he.SendPaths = append(he.SendPaths, path)
+		return
+	}
+	if ev.Origin == a.NodeId || a.eventSeen.Seen(ev.ID, common.Version{}, time.Now()) {
+		return
+	}
+	a.eventSeen.Add(ev.ID, common.Version{}, time.Now())
+	a.deliverEvent(ev)
+	a.events[ev.ID] = &hostEvent{Event: ev, SendPaths: []Path{path}, Round: a.Round}
+}
+
+// eventsToSend returns this node's new events and the received events it
+// relays this round. Events are relayed along the MLST, like node messages,
+// until they reach their hop limit.
+func (a *Agent) eventsToSend(view *common.Graph) []common.SendEvent {
+	var sends []common.SendEvent
+	for _, ev := range a.published {
+		ev.Hops = 1
+		sends = append(sends, common.SendEvent{PrevNode: a.NodeId, Event: ev})
+	}
+	a.published = nil
+
+	ids := make([]string, 0, len(a.events))
+	for id := range a.events {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		he := a.events[id]
+		if !he.Forwarded && (he.Event.HopLimit <= 0 || he.Event.Hops < he.Event.HopLimit) {
+			if p, ok := a.relayPath(view, he.SendPaths); ok {
+				ev := he.Event
+				ev.Hops++
+				sends = append(sends, common.SendEvent{PrevNode: p[len(p)-1], Event: ev})
+				he.Forwarded = true
+			}
+		}
+		if he.Forwarded || a.Round-he.Round >= RetainRounds {
+			delete(a.events, id)
+		}
+	}
+	return sends
+}
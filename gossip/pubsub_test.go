@@ -0,0 +1,153 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"testing"
+)
+
+// received drains ch and returns the IDs of the events on it.
+func received(ch <-chan common.Event) []string {
+	var ids []string
+	for len(ch) > 0 {
+		ids = append(ids, (<-ch).ID)
+	}
+	return ids
+}
+
+func TestPublish(t *testing.T) {
+	a := newTestAgent(t, "A")
+	a.EventHopLimit = 4
+	sub := a.Subscribe("t")
+	other := a.Subscribe("other")
+
+	id := a.Publish("t", []byte("x"))
+	if got := received(sub); len(got) != 1 || got[0] != id {
+		t.Fatalf("local subscriber got %v, want [%s]", got, id)
+	}
+	if got := received(other); len(got) != 0 {
+		t.Errorf("subscriber of another topic got %v", got)
+	}
+	if id2 := a.Publish("t", nil); id2 == id {
+		t.Errorf("two events with ID %s", id)
+	}
+	received(sub)
+
+	evs := a.generateGossipMessage().Events
+	if len(evs) != 2 || evs[0].Event.ID != id || evs[0].PrevNode != "A" ||
+		evs[0].Event.Hops != 1 || evs[0].Event.HopLimit != 4 {
+		t.Fatalf("sent %+v, want both events from A at hop 1 of 4", evs)
+	}
+	a.Round++
+	if evs := a.generateGossipMessage().Events; len(evs) != 0 {
+		t.Errorf("published events sent again: %+v", evs)
+	}
+}
+
+func TestHandleEventDedup(t *testing.T) {
+	b := newTestAgent(t, "B")
+	sub := b.Subscribe("t")
+	ev := common.Event{ID: "A/1/1", Origin: "A", Topic: "t", Hops: 1, HopLimit: 16}
+
+	b.handleEvent(common.SendEvent{PrevNode: "A", Event: ev}, "A")
+	b.handleEvent(common.SendEvent{PrevNode: "A", Event: ev}, "C")
+	if got := received(sub); len(got) != 1 {
+		t.Fatalf("delivered %v, want the event once", got)
+	}
+	if he := b.events[ev.ID]; he == nil || len(he.SendPaths) != 2 {
+		t.Fatalf("got %+v, want both paths recorded", he)
+	}
+
+	// once relayed or dropped, a late copy is neither delivered nor kept
+	b.Round += RetainRounds
+	b.eventsToSend(b.Graph.Snapshot())
+	b.handleEvent(common.SendEvent{PrevNode: "A", Event: ev}, "D")
+	if got := received(sub); len(got) != 0 {
+		t.Errorf("late copy delivered again")
+	}
+	if _, exist := b.events[ev.ID]; exist {
+		t.Errorf("late copy kept for relaying")
+	}
+
+	// a node's own events come back from its neighbors
+	own := common.Event{ID: "B/1/1", Origin: "B", Topic: "t"}
+	b.handleEvent(common.SendEvent{PrevNode: "B", Event: own}, "A")
+	if got := received(sub); len(got) != 0 {
+		t.Errorf("own event delivered again")
+	}
+}
+
+func TestEventsToSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		view      string
+		path      Path
+		hops      int
+		limit     int
+		relayed   bool
+		prevNode  string
+		remaining bool
+	}{
+		{"on the tree", "A-B B-C", Path{"A"}, 1, 16, true, "A", false},
+		{"via a relay", "A-D D-B B-C", Path{"A", "D"}, 2, 16, true, "D", false},
+		{"hop limit reached", "A-B B-C", Path{"A"}, 2, 2, false, "", true},
+		{"no hop limit", "A-B B-C", Path{"A"}, 100, 0, true, "A", false},
+		{"leaf", "A-B", Path{"A"}, 1, 16, false, "", true},
+		{"origin reaches all", "A-B A-C B-C A-D", Path{"A"}, 1, 16, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestAgent(t, "B")
+			ev := common.Event{ID: "A/1/1", Origin: "A", Topic: "t", Hops: tt.hops, HopLimit: tt.limit}
+			b.events[ev.ID] = &hostEvent{Event: ev, SendPaths: []Path{tt.path}, Round: b.Round}
+
+			sends := b.eventsToSend(topology(tt.view))
+			if relayed := len(sends) == 1; relayed != tt.relayed {
+				t.Fatalf("sent %+v, want relayed %v", sends, tt.relayed)
+			}
+			if tt.relayed && (sends[0].PrevNode != tt.prevNode || sends[0].Event.Hops != tt.hops+1) {
+				t.Errorf("sent %+v, want prev node %s at hop %d", sends[0], tt.prevNode, tt.hops+1)
+			}
+			if _, exist := b.events[ev.ID]; exist != tt.remaining {
+				t.Errorf("event kept %v, want %v", exist, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestEventRelayedAlongTree(t *testing.T) {
+	// the line A-B-C: B relays, C is a leaf
+	a, b, c := newTestAgent(t, "A"), newTestAgent(t, "B"), newTestAgent(t, "C")
+	deliver(t, a, b)
+	deliver(t, c, b)
+	deliver(t, b, a, c)
+	sub := c.Subscribe("t")
+
+	id := a.Publish("t", nil)
+	deliver(t, a, b)
+	b.Round++
+	deliver(t, b, c)
+	if got := received(sub); len(got) != 1 || got[0] != id {
+		t.Fatalf("C got %v, want [%s]", got, id)
+	}
+	c.Round++
+	for _, se := range c.generateGossipMessage().Events {
+		if se.Event.ID == id {
+			t.Errorf("leaf C relayed %s", id)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	a := newTestAgent(t, "A")
+	sub, keep := a.Subscribe("t"), a.Subscribe("t")
+	a.Unsubscribe("t", sub)
+	if _, open := <-sub; open {
+		t.Fatal("channel still open after Unsubscribe")
+	}
+	a.Publish("t", nil)
+	if got := received(keep); len(got) != 1 {
+		t.Errorf("remaining subscriber got %v", got)
+	}
+	// unsubscribing twice is harmless
+	a.Unsubscribe("t", sub)
+}
@@ -0,0 +1,212 @@
+package gossip
+
+import (
+	"errors"
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// QueryBufSize is the capacity of the response channel of a query. Later
+// responses are dropped when the originator does not keep up.
+var QueryBufSize = 256
+
+// QueryResult streams the responses to a query. Done and Responses are
+// closed when the deadline passes.
+type QueryResult struct {
+	ID        string
+	Responses <-chan common.Response
+	Done      <-chan struct{}
+}
+
+// pendingQuery is a query this node asked.
+type pendingQuery struct {
+	deadline  time.Time
+	responses chan common.Response
+	done      chan struct{}
+	from      map[string]bool
+}
+
+// hostQuery is a received query. Upstream is the neighbor it first came
+// from, responses travel back that way. Deadline is local, the Timeout of
+// the query added to the time of receipt.
+type hostQuery struct {
+	Query     common.Query
+	Deadline  time.Time
+	SendPaths []Path
+	Upstream  string
+	Forwarded bool
+	from      map[string]bool
+}
+
+// Query asks every node whose state matches filter, see common.ParseFilter,
+// for its state. The query fans out along the MLST like published events
+// and the responses come back along the reverse path until timeout.
+func (a *Agent) Query(filter string, timeout time.Duration) (*QueryResult, error) {
+	f, err := common.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, errors.New("query timeout must be positive")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.eventSeq++
+	limit := a.EventHopLimit
+	if limit == 0 {
+		limit = DefaultEventHopLimit
+	}
+	q := common.Query{
+		ID:       a.NodeId + "/" + strconv.FormatInt(a.BootID, 10) + "/q" + strconv.Itoa(a.eventSeq),
+		Origin:   a.NodeId,
+		Filter:   filter,
+		HopLimit: limit,
+	}
+	pq := &pendingQuery{
+		deadline:  time.Now().Add(timeout),
+		responses: make(chan common.Response, QueryBufSize),
+		done:      make(chan struct{}),
+		from:      make(map[string]bool),
+	}
+	if a.pendingQueries == nil {
+		a.pendingQueries = make(map[string]*pendingQuery)
+	}
+	a.pendingQueries[q.ID] = pq
+	a.eventSeen.Add(q.ID, common.Version{}, time.Now())
+	a.askedQueries = append(a.askedQueries, q)
+	if f.Match(a.stateCopy()) {
+		a.deliverResponse(pq, common.Response{QueryID: q.ID, Origin: a.NodeId, From: a.NodeId, Data: a.stateCopy()})
+	}
+	time.AfterFunc(timeout, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.pendingQueries, q.ID)
+		close(pq.responses)
+		close(pq.done)
+	})
+	return &QueryResult{ID: q.ID, Responses: pq.responses, Done: pq.done}, nil
+}
+
+func (a *Agent) deliverResponse(pq *pendingQuery, r common.Response) {
+	if pq.from[r.From] {
+		return
+	}
+	pq.from[r.From] = true
+	select {
+	case pq.responses <- r:
+	default:
+		fmt.Println(a.NodeId, " drop response of ", r.From, " to query ", r.QueryID)
+	}
+}
+
+// handleQuery takes a query relayed by sender. The first copy is answered
+// if this node's state matches its filter.
+func (a *Agent) handleQuery(sq common.SendQuery, sender string) {
+	q := sq.Query
+	path := Path{sender}
+	if sq.PrevNode != sender {
+		path = Path{sq.PrevNode, sender}
+	}
+	if hq, exist := a.queries[q.ID]; exist {
+		hq.SendPaths = append(hq.SendPaths, path)
+		return
+	}
+	if q.Origin == a.NodeId || a.eventSeen.Seen(q.ID, common.Version{}, time.Now()) {
+		return
+	}
+	a.eventSeen.Add(q.ID, common.Version{}, time.Now())
+	if q.Timeout <= 0 {
+		return
+	}
+	a.queries[q.ID] = &hostQuery{
+		Query:     q,
+		Deadline:  time.Now().Add(q.Timeout),
+		SendPaths: []Path{path},
+		Upstream:  sender,
+		from:      make(map[string]bool),
+	}
+	f, err := common.ParseFilter(q.Filter)
+	if err != nil {
+		fmt.Println(a.NodeId, " bad query filter ", q.Filter, ": ", err)
+		return
+	}
+	if f.Match(a.stateCopy()) {
+		a.routeResponse(common.Response{QueryID: q.ID, Origin: q.Origin, From: a.NodeId, Data: a.stateCopy()})
+	}
+}
+
+// handleResponse takes a response addressed to this node, delivering it if
+// this node asked and passing it upstream otherwise.
+func (a *Agent) handleResponse(r common.Response) {
+	if r.NextHop != a.NodeId {
+		return
+	}
+	if pq, exist := a.pendingQueries[r.QueryID]; exist {
+		a.deliverResponse(pq, r)
+		return
+	}
+	a.routeResponse(r)
+}
+
+// routeResponse queues r for the neighbor its query came from.
+func (a *Agent) routeResponse(r common.Response) {
+	hq, exist := a.queries[r.QueryID]
+	if !exist || hq.from[r.From] {
+		return
+	}
+	hq.from[r.From] = true
+	r.NextHop = hq.Upstream
+	a.responses = append(a.responses, r)
+}
+
+// queriesToSend returns this node's new queries and the received queries
+// it relays this round, each with the time left until its deadline, and
+// forgets queries past their deadline.
+func (a *Agent) queriesToSend(view *common.Graph) []common.SendQuery {
+	var sends []common.SendQuery
+	now := time.Now()
+	for _, q := range a.askedQueries {
+		pq, exist := a.pendingQueries[q.ID]
+		if !exist {
+			continue
+		}
+		q.Hops = 1
+		q.Timeout = pq.deadline.Sub(now)
+		sends = append(sends, common.SendQuery{PrevNode: a.NodeId, Query: q})
+	}
+	a.askedQueries = nil
+
+	ids := make([]string, 0, len(a.queries))
+	for id := range a.queries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		hq := a.queries[id]
+		if now.After(hq.Deadline) {
+			delete(a.queries, id)
+			continue
+		}
+		if hq.Forwarded || (hq.Query.HopLimit > 0 && hq.Query.Hops >= hq.Query.HopLimit) {
+			continue
+		}
+		if p, ok := a.relayPath(view, hq.SendPaths); ok {
+			q := hq.Query
+			q.Hops++
+			q.Timeout = hq.Deadline.Sub(now)
+			sends = append(sends, common.SendQuery{PrevNode: p[len(p)-1], Query: q})
+			hq.Forwarded = true
+		}
+	}
+	return sends
+}
+
+// responsesToSend returns the queued responses.
+func (a *Agent) responsesToSend() []common.Response {
+	rs := a.responses
+	a.responses = nil
+	return rs
+}
@@ -0,0 +1,44 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	a, b := newTestAgent(t, "A"), newTestAgent(t, "B")
+	a.HandleMsg(b.generateGossipMessage())
+	b.HandleMsg(a.generateGossipMessage())
+
+	res, err := a.Query("", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	msg := a.generateGossipMessage()
+	if len(msg.Queries) != 1 {
+		t.Fatalf("sent %d queries, want 1", len(msg.Queries))
+	}
+	timeout := msg.Queries[0].Query.Timeout
+	if timeout <= 0 || timeout > time.Second-50*time.Millisecond {
+		t.Fatalf("sent timeout %v, want what is left of 1s", timeout)
+	}
+
+	// the receiver keeps a deadline on its own clock
+	before := time.Now()
+	b.HandleMsg(msg)
+	hq, exist := b.queries[res.ID]
+	if !exist {
+		t.Fatal("B did not take the query")
+	}
+	if hq.Deadline.Before(before.Add(timeout)) || hq.Deadline.After(time.Now().Add(timeout)) {
+		t.Errorf("deadline %v is not the timeout %v after receipt", hq.Deadline, timeout)
+	}
+
+	// an expired query is not taken
+	b.handleQuery(common.SendQuery{PrevNode: "A", Query: common.Query{ID: "A/0/q99", Origin: "A"}}, "A")
+	if _, exist := b.queries["A/0/q99"]; exist {
+		t.Errorf("B took a query without time left")
+	}
+}
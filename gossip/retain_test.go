@@ -0,0 +1,74 @@
+package gossip
+
+import (
+	"testing"
+
+	"github.com/meixiezichuan/broadcast-gossip/common"
+)
+
+// relayed returns the message of origin carried in msg and the neighbor it
+// was received from.
+func relayed(msg common.GossipMessage, origin string) (string, bool) {
+	for _, m := range msg.Msgs {
+		if m.NodeMsg.NodeID == origin {
+			return m.PrevNode, true
+		}
+	}
+	return "", false
+}
+
+// leafRelay returns A at the end of the line C-B-A holding C's message,
+// which A, a leaf of C's tree, did not relay.
+func leafRelay(t *testing.T) *Agent {
+	t.Helper()
+	a, b, c := newTestAgent(t, "A"), newTestAgent(t, "B"), newTestAgent(t, "C")
+	deliver(t, c, b)
+	deliver(t, a, b)
+	deliver(t, b, a)
+	if _, exist := a.Msgs["C"]; !exist {
+		t.Fatal("C's message did not reach A")
+	}
+	if _, ok := relayed(a.generateGossipMessage(), "C"); ok {
+		t.Fatal("A relayed C's message as a leaf")
+	}
+	return a
+}
+
+func TestRetainedMessageResentAfterTopologyChange(t *testing.T) {
+	a := leafRelay(t)
+	for i := 1; i < RetainRounds; i++ {
+		a.Round++
+		if _, ok := relayed(a.generateGossipMessage(), "C"); ok {
+			t.Fatalf("round %d: relayed without a topology change", a.Round)
+		}
+		if _, exist := a.Msgs["C"]; !exist {
+			t.Fatalf("round %d: message dropped before RetainRounds", a.Round)
+		}
+	}
+
+	// D joins behind A, which now is on C's tree
+	deliver(t, newTestAgent(t, "D"), a)
+	prev, ok := relayed(a.generateGossipMessage(), "C")
+	if !ok || prev != "B" {
+		t.Fatalf("retained message not relayed after the topology change, prev %q", prev)
+	}
+	a.Round++
+	if _, ok := relayed(a.generateGossipMessage(), "C"); ok {
+		t.Error("relayed message sent again")
+	}
+}
+
+func TestRetainedMessageDropped(t *testing.T) {
+	a := leafRelay(t)
+	a.Round += RetainRounds
+	a.generateGossipMessage()
+	if _, exist := a.Msgs["C"]; exist {
+		t.Fatalf("message kept for more than %d rounds", RetainRounds)
+	}
+
+	// a topology change no longer brings it back
+	deliver(t, newTestAgent(t, "D"), a)
+	if _, ok := relayed(a.generateGossipMessage(), "C"); ok {
+		t.Error("dropped message relayed")
+	}
+}
@@ -0,0 +1,123 @@
+package gossip
+
+import (
+	"container/list"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sync"
+	"time"
+)
+
+// SeenCacheSize and SeenCacheTTL bound the duplicate suppression cache.
+var (
+	SeenCacheSize = 4096
+	SeenCacheTTL  = 10 * time.Minute
+)
+
+// SeenCache remembers, per origin, the newest (incarnation, revision) this
+// node already took a forwarding decision on. Messages at or below that
+// version are duplicates or stale and are dropped before they reach the
+// forwarding logic. The cache holds at most capacity origins and forgets
+// entries that were not refreshed within ttl, oldest first.
+type SeenCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	// order lists entries from least to most recently added
+	order *list.List
+	stats SeenStats
+}
+
+type seenEntry struct {
+	origin  string
+	version common.Version
+	at      time.Time
+}
+
+// SeenStats counts the lookups of a SeenCache. Hits are exact duplicates,
+// Stale are older versions, Misses are messages let through.
+type SeenStats struct {
+	Hits      uint64
+	Stale     uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+func NewSeenCache(capacity int, ttl time.Duration) *SeenCache {
+	return &SeenCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Seen reports whether the message of origin at version was already
+// handled, and counts the lookup.
+func (c *SeenCache) Seen(origin string, version common.Version, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+	elem, exist := c.entries[origin]
+	if !exist {
+		c.stats.Misses++
+		return false
+	}
+	seen := elem.Value.(*seenEntry).version
+	switch {
+	case seen == version:
+		c.stats.Hits++
+		return true
+	case version.Less(seen):
+		c.stats.Stale++
+		return true
+	}
+	c.stats.Misses++
+	return false
+}
+
+// Add records that the message of origin at version was handled.
+func (c *SeenCache) Add(origin string, version common.Version, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, exist := c.entries[origin]; exist {
+		e := elem.Value.(*seenEntry)
+		if version.Less(e.version) {
+			return
+		}
+		e.version = version
+		e.at = now
+		c.order.MoveToBack(elem)
+		return
+	}
+	c.entries[origin] = c.order.PushBack(&seenEntry{origin: origin, version: version, at: now})
+	for c.order.Len() > c.capacity {
+		c.evict(c.order.Front())
+	}
+	c.expire(now)
+}
+
+// Stats returns a copy of the lookup counters.
+func (c *SeenCache) Stats() SeenStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.order.Len()
+	return s
+}
+
+func (c *SeenCache) expire(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if now.Sub(elem.Value.(*seenEntry).at) < c.ttl {
+			return
+		}
+		c.evict(elem)
+	}
+}
+
+func (c *SeenCache) evict(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*seenEntry).origin)
+	c.stats.Evictions++
+}
@@ -0,0 +1,110 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"testing"
+	"time"
+)
+
+func TestSeenCacheLookup(t *testing.T) {
+	now := time.Now()
+	c := NewSeenCache(10, time.Minute)
+	c.Add("A", common.Version{Incarnation: 1, Revision: 5}, now)
+
+	tests := []struct {
+		name    string
+		origin  string
+		version common.Version
+		seen    bool
+	}{
+		{"duplicate", "A", common.Version{Incarnation: 1, Revision: 5}, true},
+		{"older revision", "A", common.Version{Incarnation: 1, Revision: 4}, true},
+		{"older incarnation", "A", common.Version{Incarnation: 0, Revision: 9}, true},
+		{"newer revision", "A", common.Version{Incarnation: 1, Revision: 6}, false},
+		{"restart", "A", common.Version{Incarnation: 2, Revision: 0}, false},
+		{"unknown origin", "B", common.Version{Incarnation: 1, Revision: 5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Seen(tt.origin, tt.version, now); got != tt.seen {
+				t.Errorf("Seen = %v, want %v", got, tt.seen)
+			}
+		})
+	}
+	want := SeenStats{Hits: 1, Stale: 2, Misses: 3, Size: 1}
+	if s := c.Stats(); s != want {
+		t.Errorf("stats %+v, want %+v", s, want)
+	}
+
+	// an older version never replaces a newer one
+	c.Add("A", common.Version{Incarnation: 1, Revision: 2}, now)
+	if !c.Seen("A", common.Version{Incarnation: 1, Revision: 5}, now) {
+		t.Errorf("older Add replaced the newer version")
+	}
+}
+
+func TestSeenCacheEviction(t *testing.T) {
+	start := time.Now()
+	v := common.Version{Revision: 1}
+	tests := []struct {
+		name      string
+		capacity  int
+		ttl       time.Duration
+		adds      []string
+		refresh   string
+		lookupAt  time.Duration
+		kept      []string
+		evicted   []string
+		evictions uint64
+	}{
+		{
+			name: "capacity drops the oldest", capacity: 2, ttl: time.Hour,
+			adds: []string{"A", "B", "C"}, lookupAt: 3 * time.Second,
+			kept: []string{"B", "C"}, evicted: []string{"A"}, evictions: 1,
+		},
+		{
+			name: "refresh keeps an origin", capacity: 2, ttl: time.Hour,
+			adds: []string{"A", "B", "C"}, refresh: "A", lookupAt: 3 * time.Second,
+			kept: []string{"A", "C"}, evicted: []string{"B"}, evictions: 1,
+		},
+		{
+			name: "ttl expires old entries", capacity: 10, ttl: 2500 * time.Millisecond,
+			adds: []string{"A", "B", "C"}, lookupAt: 4 * time.Second,
+			kept: []string{"C"}, evicted: []string{"A", "B"}, evictions: 2,
+		},
+		{
+			name: "refresh restarts the ttl", capacity: 10, ttl: 2500 * time.Millisecond,
+			adds: []string{"A", "B", "C"}, refresh: "A", lookupAt: 4 * time.Second,
+			kept: []string{"A", "C"}, evicted: []string{"B"}, evictions: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewSeenCache(tt.capacity, tt.ttl)
+			// origin i is added at second i, the refresh lands between the
+			// second and third add
+			for i, o := range tt.adds {
+				at := start.Add(time.Duration(i) * time.Second)
+				if i == 2 && tt.refresh != "" {
+					c.Add(tt.refresh, common.Version{Revision: 2}, at.Add(-time.Millisecond))
+				}
+				c.Add(o, v, at)
+			}
+			now := start.Add(tt.lookupAt)
+			for _, o := range tt.kept {
+				if !c.Seen(o, v, now) {
+					t.Errorf("%s was evicted", o)
+				}
+			}
+			for _, o := range tt.evicted {
+				if c.Seen(o, v, now) {
+					t.Errorf("%s was kept", o)
+				}
+			}
+			s := c.Stats()
+			if s.Evictions != tt.evictions || s.Size != len(tt.kept) {
+				t.Errorf("stats %+v, want %d evictions and size %d", s, tt.evictions, len(tt.kept))
+			}
+		})
+	}
+}
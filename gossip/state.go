@@ -0,0 +1,184 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/collector"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"math"
+	"sort"
+)
+
+// StateChange describes one key of an origin's state that changed when a
+// newer message from it was received. Deleted is set when the key is gone.
+type StateChange struct {
+	Node    string
+	Key     string
+	Old     common.Value
+	New     common.Value
+	Deleted bool
+}
+
+// SetState sets key to value in this node's state. The state is gossiped
+// in the node's own message from the next round on.
+func (a *Agent) SetState(key string, value common.Value) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == nil {
+		a.state = make(map[string]common.Value)
+	}
+	a.state[key] = value
+}
+
+// DeleteState removes key from this node's state.
+func (a *Agent) DeleteState(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.state, key)
+}
+
+// GetState returns the value of key in the newest state known from node.
+func (a *Agent) GetState(node, key string) (common.Value, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if node == a.NodeId {
+		v, exist := a.state[key]
+		return v, exist
+	}
+	s, exist := a.store[node]
+	if !exist {
+		return common.Value{}, false
+	}
+	v, exist := s.Msg.Data[key]
+	return v, exist
+}
+
+// StateQueueSize bounds the changes waiting for the OnStateChange
+// callbacks. When the callbacks do not keep up the oldest changes are
+// dropped.
+var StateQueueSize = 1024
+
+// OnStateChange registers fn to be called for every change of another
+// node's state. Callbacks run in order on a separate goroutine, so they may
+// call back into the agent.
+func (a *Agent) OnStateChange(fn func(StateChange)) {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	a.stateSubs = append(a.stateSubs, fn)
+	if a.stateWake == nil {
+		a.stateWake = make(chan struct{}, 1)
+		go a.dispatchState()
+	}
+}
+
+// A collected number only replaces the gossiped one once it moved by more
+// than MetricChange of it, or by more than MetricPoints for percentages, so
+// jitter does not bump the revision every round.
+var (
+	MetricChange = 0.1
+	MetricPoints = 5.0
+)
+
+// collectMetrics reads every collector and merges its metrics into the
+// state, keyed by metric name.
+func (a *Agent) collectMetrics() {
+	for _, c := range a.Collectors {
+		ms, err := c.Collect()
+		if err != nil {
+			fmt.Println(a.NodeId, " collector ", c.Name(), " failed: ", err)
+			continue
+		}
+		if a.state == nil && len(ms) > 0 {
+			a.state = make(map[string]common.Value)
+		}
+		for _, m := range ms {
+			if old, exist := a.state[m.Name]; !exist || metricMoved(old, m) {
+				a.state[m.Name] = metricValue(m)
+			}
+		}
+	}
+}
+
+// metricMoved reports whether m differs enough from old, the value gossiped
+// so far, to be gossiped instead.
+func metricMoved(old common.Value, m collector.Metric) bool {
+	v := metricValue(m)
+	if old.Kind != v.Kind || m.Unit == collector.UnitBool {
+		return !old.Equal(v)
+	}
+	n, _ := old.Number()
+	if m.Unit == collector.UnitPercent {
+		return math.Abs(m.Value-n) > MetricPoints
+	}
+	return math.Abs(m.Value-n) > MetricChange*math.Abs(n)
+}
+
+// metricValue converts m to the typed value it is gossiped as.
+func metricValue(m collector.Metric) common.Value {
+	switch m.Unit {
+	case collector.UnitBool:
+		return common.BoolValue(m.Value != 0)
+	case collector.UnitBytes:
+		return common.BytesValue(uint64(m.Value))
+	}
+	return common.NumberValue(m.Value)
+}
+
+// stateCopy returns a copy of this node's state to be sent.
+func (a *Agent) stateCopy() map[string]common.Value {
+	data := make(map[string]common.Value, len(a.state))
+	for k, v := range a.state {
+		data[k] = v
+	}
+	return data
+}
+
+// stateChanged queues the differences between old and cur, the previous and
+// the new state of node, for the OnStateChange callbacks.
+func (a *Agent) stateChanged(node string, old, cur map[string]common.Value) {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+	if len(a.stateSubs) == 0 {
+		return
+	}
+	var changes []StateChange
+	for k, v := range cur {
+		if o, exist := old[k]; !exist || !o.Equal(v) {
+			changes = append(changes, StateChange{Node: node, Key: k, Old: o, New: v})
+		}
+	}
+	for k, o := range old {
+		if _, exist := cur[k]; !exist {
+			changes = append(changes, StateChange{Node: node, Key: k, Old: o, Deleted: true})
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	a.stateQueue = append(a.stateQueue, changes...)
+	if drop := len(a.stateQueue) - StateQueueSize; drop > 0 {
+		fmt.Println(a.NodeId, " state callbacks behind, dropped ", drop, " changes")
+		a.stateQueue = append([]StateChange(nil), a.stateQueue[drop:]...)
+	}
+	select {
+	case a.stateWake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Agent) dispatchState() {
+	for range a.stateWake {
+		a.subMu.Lock()
+		changes := a.stateQueue
+		a.stateQueue = nil
+		subs := append([]func(StateChange){}, a.stateSubs...)
+		a.subMu.Unlock()
+		for _, c := range changes {
+			for _, fn := range subs {
+				fn(c)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/collector"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// fakeCollector returns the metrics it is set to.
+type fakeCollector struct {
+	metrics []collector.Metric
+}
+
+func (c *fakeCollector) Name() string { return "fake" }
+
+func (c *fakeCollector) Collect() ([]collector.Metric, error) {
+	return c.metrics, nil
+}
+
+func TestMetricJitterKeepsRevision(t *testing.T) {
+	c := &fakeCollector{}
+	a := newTestAgent(t, "A")
+	a.Collectors = []collector.Collector{c}
+	set := func(cpu, mem, up float64) {
+		c.metrics = []collector.Metric{
+			{Name: "cpu.usage", Unit: collector.UnitPercent, Value: cpu},
+			{Name: "mem.available", Unit: collector.UnitBytes, Value: mem},
+			{Name: "online", Unit: collector.UnitBool, Value: up},
+		}
+	}
+	set(40, 1000, 1)
+	rev := a.selfMessage().Revision
+
+	steps := []struct {
+		name         string
+		cpu, mem, up float64
+		bump         bool
+	}{
+		{"same", 40, 1000, 1, false},
+		{"cpu jitter", 43, 1000, 1, false},
+		{"memory jitter", 40, 1080, 1, false},
+		{"cpu moved", 46, 1000, 1, true},
+		{"cpu back within points", 42, 1000, 1, false},
+		{"memory moved", 46, 1200, 1, true},
+		{"bool flipped", 46, 1200, 0, true},
+	}
+	for _, s := range steps {
+		set(s.cpu, s.mem, s.up)
+		got := a.selfMessage().Revision
+		if bumped := got > rev; bumped != s.bump {
+			t.Errorf("%s: revision %d -> %d, want bump %v", s.name, rev, got, s.bump)
+		}
+		rev = got
+	}
+}
+
+func TestStateQueueDropsOldest(t *testing.T) {
+	size := StateQueueSize
+	StateQueueSize = 3
+	t.Cleanup(func() { StateQueueSize = size })
+
+	a := newTestAgent(t, "A")
+	block := make(chan struct{})
+	got := make(chan StateChange, 16)
+	a.OnStateChange(func(c StateChange) {
+		<-block
+		got <- c
+	})
+
+	queued := func() int {
+		a.subMu.Lock()
+		defer a.subMu.Unlock()
+		return len(a.stateQueue)
+	}
+	change := func(i int) {
+		a.stateChanged("B", nil, map[string]common.Value{"k" + strconv.Itoa(i): common.StringValue("v")})
+	}
+
+	// the first change is taken by the callback, which then blocks
+	change(0)
+	for queued() > 0 {
+		runtime.Gosched()
+	}
+	for i := 1; i <= 5; i++ {
+		change(i)
+	}
+	if n := queued(); n != StateQueueSize {
+		t.Fatalf("%d changes queued, want %d", n, StateQueueSize)
+	}
+	close(block)
+
+	var keys []string
+	for len(keys) < 4 {
+		keys = append(keys, (<-got).Key)
+	}
+	if want := []string{"k0", "k3", "k4", "k5"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("delivered %v, want %v", keys, want)
+	}
+}
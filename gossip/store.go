@@ -0,0 +1,92 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+	"time"
+)
+
+// HistorySize is how many recent revisions are kept per origin to answer NACKs.
+var HistorySize = 16
+
+// StoredMsg is the newest message known from one origin. Route is the path
+// it took, when known.
+type StoredMsg struct {
+	Msg      common.NodeMessage
+	Received time.Time
+	Route    []string
+}
+
+// storeMsg keeps msg if it is newer than what is stored for its origin and
+// reports whether it was. Deltas are merged into the stored state, one that
+// cannot be applied is asked for in full by a NACK. A new incarnation of a
+// known origin is a restart.
+func (a *Agent) storeMsg(msg common.NodeMessage) bool {
+	old, exist := a.store[msg.NodeID]
+	if exist && !old.Msg.Version().Less(msg.Version()) {
+		return false
+	}
+	if msg.Delta {
+		full, ok := mergeDelta(old, exist, msg)
+		if !ok {
+			a.nackRevision(msg.NodeID, msg.Incarnation, msg.Revision)
+			return false
+		}
+		msg = full
+	}
+	if msg.Schema > common.SchemaVersion && (!exist || old.Msg.Schema != msg.Schema) {
+		fmt.Println(a.NodeId, " origin ", msg.NodeID, " runs newer schema ", msg.Schema, ", unknown values are kept as is")
+	}
+	a.store[msg.NodeID] = StoredMsg{Msg: msg, Received: time.Now()}
+	if msg.NodeID != a.NodeId {
+		a.stateChanged(msg.NodeID, old.Msg.Data, msg.Data)
+	}
+	a.remember(msg)
+	a.resolveNacks(msg)
+	a.carry(msg)
+	if exist && old.Msg.Incarnation < msg.Incarnation {
+		a.nodeRestarted(msg.NodeID)
+	}
+	return true
+}
+
+// remember adds msg to the recent history of its origin, which is what
+// NACKs are answered from.
+func (a *Agent) remember(msg common.NodeMessage) {
+	h := a.history[msg.NodeID]
+	for _, m := range h {
+		if m.Version() == msg.Version() {
+			return
+		}
+	}
+	h = append(h, msg)
+	sort.Slice(h, func(i, j int) bool {
+		return h[i].Version().Less(h[j].Version())
+	})
+	if len(h) > HistorySize {
+		h = h[len(h)-HistorySize:]
+	}
+	a.history[msg.NodeID] = h
+}
+
+// digest returns the stored version of every origin.
+func (a *Agent) digest() map[string]common.Version {
+	d := make(map[string]common.Version, len(a.store))
+	for n, s := range a.store {
+		d[n] = s.Msg.Version()
+	}
+	return d
+}
+
+// missingFrom returns the stored messages that are absent from, or newer
+// than, the entries of digest d.
+func (a *Agent) missingFrom(d map[string]common.Version) []common.NodeMessage {
+	var msgs []common.NodeMessage
+	for n, s := range a.store {
+		if v, exist := d[n]; !exist || v.Less(s.Msg.Version()) {
+			msgs = append(msgs, s.Msg)
+		}
+	}
+	return msgs
+}
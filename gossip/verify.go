@@ -0,0 +1,128 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"sort"
+)
+
+// OriginCoverage is the outcome of disseminating one origin's message.
+type OriginCoverage struct {
+	Origin string
+	// Relays are the nodes that forwarded the message, the origin excluded.
+	Relays []string
+	// Redundant are relays whose transmission reached no node for the first time.
+	Redundant []string
+	// Uncovered are the nodes that never received the message.
+	Uncovered []string
+	// Hops is the round in which each node first received the message.
+	Hops map[string]int
+	// TreeDepth is the depth of the tree the mode builds from the origin over
+	// the whole topology, the hops needed when every view were complete.
+	TreeDepth int
+}
+
+// CoverageReport collects the outcome for every origin of a topology.
+type CoverageReport struct {
+	Mode    string
+	Origins []OriginCoverage
+}
+
+// Covered reports whether every origin reached every node.
+func (r CoverageReport) Covered() bool {
+	for _, o := range r.Origins {
+		if len(o.Uncovered) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyCoverage checks offline that the local relay decisions taken by the
+// agents add up to a full broadcast. Every node only sees its LocalView of
+// topo, exactly what it learns through gossip, and decides like
+// generateGossipMessage: it relays in the round after it first receives the
+// message if any of the paths received in that round passes checkPath.
+// mode and maxDepth select the tree builder as in NodeMessage.
+func VerifyCoverage(topo *common.Graph, mode string, maxDepth int) CoverageReport {
+	report := CoverageReport{Mode: mode}
+	views := make(map[string]*common.Graph)
+	for _, n := range topo.Vertices() {
+		views[n] = topo.LocalView(n).Snapshot()
+	}
+	for _, origin := range topo.Vertices() {
+		msg := common.NodeMessage{NodeID: origin, TreeMode: mode, TreeDepth: maxDepth}
+		cov := simulateOrigin(topo, views, msg)
+		cov.TreeDepth = topo.BuildTree(mode, origin, maxDepth).TreeDepth()
+		report.Origins = append(report.Origins, cov)
+	}
+	return report
+}
+
+type transmission struct {
+	sender   string
+	prevNode string
+}
+
+func simulateOrigin(topo *common.Graph, views map[string]*common.Graph, msg common.NodeMessage) OriginCoverage {
+	cov := OriginCoverage{
+		Origin: msg.NodeID,
+		Hops:   map[string]int{msg.NodeID: 0},
+	}
+	sending := []transmission{{sender: msg.NodeID}}
+	for round := 1; len(sending) > 0; round++ {
+		received := make(map[string][]Path)
+		for _, t := range sending {
+			reachedNew := false
+			for _, r := range topo.FindNeighbor(t.sender) {
+				if _, had := cov.Hops[r]; had && cov.Hops[r] < round {
+					continue
+				}
+				reachedNew = true
+				cov.Hops[r] = round
+				// the origin sends its own message as Self, relays as SendMessage
+				p := Path{t.sender}
+				if t.prevNode != "" {
+					p = Path{t.prevNode, t.sender}
+				}
+				received[r] = append(received[r], p)
+			}
+			if !reachedNew && t.sender != msg.NodeID {
+				cov.Redundant = append(cov.Redundant, t.sender)
+			}
+		}
+
+		sending = nil
+		for _, r := range sortedKeys(received) {
+			paths := received[r]
+			sort.Slice(paths, func(i, j int) bool {
+				return paths[i][0] < paths[j][0]
+			})
+			for _, p := range paths {
+				allP := append(append(Path{}, p...), r)
+				if checkPath(r, views[r], allP, msg).Passed {
+					sending = append(sending, transmission{sender: r, prevNode: p[len(p)-1]})
+					cov.Relays = append(cov.Relays, r)
+					break
+				}
+			}
+		}
+	}
+
+	for _, n := range topo.Vertices() {
+		if _, ok := cov.Hops[n]; !ok {
+			cov.Uncovered = append(cov.Uncovered, n)
+		}
+	}
+	sort.Strings(cov.Relays)
+	sort.Strings(cov.Redundant)
+	return cov
+}
+
+func sortedKeys(m map[string][]Path) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,83 @@
+package gossip
+
+import (
+	"github.com/meixiezichuan/broadcast-gossip/common"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// topology builds a graph from edges written like "A-B B-C".
+func topology(edges string) *common.Graph {
+	g := common.NewGraph()
+	for _, e := range strings.Fields(edges) {
+		vs := strings.Split(e, "-")
+		g.AddEdge(vs[0], vs[1])
+	}
+	return g
+}
+
+func TestVerifyCoverage(t *testing.T) {
+	// a path A-B-C-D with the branch B-E-F closing back to C
+	topo := "A-B B-C C-D B-E E-F C-F"
+	tests := []struct {
+		name      string
+		topo      string
+		mode      string
+		relays    map[string][]string
+		treeDepth map[string]int
+	}{
+		{
+			name: "mlst", topo: topo, mode: common.TreeMLST,
+			relays: map[string][]string{
+				"A": {"B", "C"}, "B": {"C"}, "C": {"B"},
+				"D": {"B", "C"}, "E": {"B", "C"}, "F": {"B", "C"},
+			},
+			treeDepth: map[string]int{"A": 3, "B": 2, "C": 2, "D": 3, "E": 3, "F": 3},
+		},
+		{
+			name: "spt", topo: topo, mode: common.TreeSPT,
+			relays: map[string][]string{
+				"A": {"B", "C"}, "B": {"C"}, "C": {"B"},
+				"D": {"B", "C"}, "E": {"B", "C"}, "F": {"B", "C"},
+			},
+			treeDepth: map[string]int{"A": 3, "B": 2, "C": 2, "D": 3, "E": 3, "F": 3},
+		},
+		{
+			name: "star", topo: "H-A H-B H-C H-D", mode: common.TreeMLST,
+			relays:    map[string][]string{"A": {"H"}, "B": {"H"}, "C": {"H"}, "D": {"H"}, "H": nil},
+			treeDepth: map[string]int{"A": 2, "B": 2, "C": 2, "D": 2, "H": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := VerifyCoverage(topology(tt.topo), tt.mode, 0)
+			if !report.Covered() {
+				t.Errorf("not covered: %+v", report.Origins)
+			}
+			for _, o := range report.Origins {
+				if !reflect.DeepEqual(o.Relays, tt.relays[o.Origin]) {
+					t.Errorf("origin %s: relays %v, want %v", o.Origin, o.Relays, tt.relays[o.Origin])
+				}
+				if len(o.Redundant) != 0 {
+					t.Errorf("origin %s: redundant relays %v", o.Origin, o.Redundant)
+				}
+				if o.TreeDepth != tt.treeDepth[o.Origin] {
+					t.Errorf("origin %s: tree depth %d, want %d", o.Origin, o.TreeDepth, tt.treeDepth[o.Origin])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCoverageUncovered(t *testing.T) {
+	report := VerifyCoverage(topology("A-B X-Y"), common.TreeMLST, 0)
+	if report.Covered() {
+		t.Fatalf("two components reported as covered")
+	}
+	for _, o := range report.Origins {
+		if o.Origin == "A" && !reflect.DeepEqual(o.Uncovered, []string{"X", "Y"}) {
+			t.Errorf("A leaves %v uncovered, want [X Y]", o.Uncovered)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/meixiezichuan/broadcast-gossip/collector"
 	"github.com/meixiezichuan/broadcast-gossip/gossip"
 	"math/rand"
 	"net"
@@ -21,17 +22,51 @@ func runSimulation(node string, port int, wg *sync.WaitGroup, ep int) {
 func runAgent(node string, port int, ep int) {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	done := make(chan bool, 1)
+	done := make(chan bool)
 	go func() {
 		sig := <-sigs
 		fmt.Println("Get sig ", sig, "Exiting ……")
-		done <- true
+		// closing reaches every goroutine of the agent, not just one
+		close(done)
 	}()
-	agent := gossip.InitAgent(node, port)
+	// the database and message log go to DataDir, the working directory by default
+	agent := gossip.InitAgent(node, port, os.Getenv("DataDir"))
+	configureAgent(agent)
 	fmt.Println(agent.NodeId, "Start Running ", ep, " epoch.")
 	agent.Start(done, ep)
 }
 
+// configureAgent applies the optional tuning knobs passed through the environment.
+func configureAgent(agent *gossip.Agent) {
+	if mode, exist := os.LookupEnv("TreeMode"); exist {
+		agent.TreeMode = mode
+	}
+	if depth, exist := os.LookupEnv("TreeMaxDepth"); exist {
+		agent.TreeMaxDepth, _ = strconv.Atoi(depth)
+	}
+	if thr, exist := os.LookupEnv("PhiThreshold"); exist {
+		if v, err := strconv.ParseFloat(thr, 64); err == nil {
+			agent.FD.Threshold = v
+		}
+	}
+	if key, exist := os.LookupEnv("GossipKey"); exist {
+		agent.Key = []byte(key)
+	}
+	if mode, exist := os.LookupEnv("DTNMode"); exist {
+		agent.DTNMode, _ = strconv.ParseBool(mode)
+	}
+	if port, exist := os.LookupEnv("AdminPort"); exist {
+		agent.AdminAddr = ":" + port
+	}
+	if limit, exist := os.LookupEnv("EventHopLimit"); exist {
+		agent.EventHopLimit, _ = strconv.Atoi(limit)
+	}
+	// HostRoot is where the host's /proc and /sys are mounted inside a container
+	if collect, _ := strconv.ParseBool(os.Getenv("CollectMetrics")); collect {
+		agent.Collectors = collector.Default(os.Getenv("HostRoot"))
+	}
+}
+
 func Simulation(ep int) {
 	// 模拟创建 5 个边缘节点
 	var wg sync.WaitGroup